@@ -1,10 +1,17 @@
 package app
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/jpr98/apis_pf_back/datastore"
+	"github.com/jpr98/apis_pf_back/metrics"
+	"github.com/jpr98/apis_pf_back/tracing"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -14,6 +21,25 @@ type server struct {
 	database *datastore.MongoDatastore
 	storage  *datastore.StorageDatastore
 	logger   echo.Logger
+	secret   []byte
+}
+
+// defaultRequestTimeout is used when $REQUEST_TIMEOUT is not set
+const defaultRequestTimeout = 10 * time.Second
+
+// defaultJWTSecret is used when $JWT_SECRET is not set
+const defaultJWTSecret = "secret"
+
+// shutdownTimeout is how long the requests in flight and the pending spans have to finish on exit
+const shutdownTimeout = 10 * time.Second
+
+// defaultMetricsAddr is used when $METRICS_ADDR is not set
+const defaultMetricsAddr = "localhost:9090"
+
+// routeTimeouts are the deadlines of the routes that need more than the request timeout,
+// uploads of large images had 50 seconds before they used the request context
+var routeTimeouts = map[string]time.Duration{
+	"/upload": 50 * time.Second,
 }
 
 var appServer = server{}
@@ -27,29 +53,73 @@ func StartServer() {
 		appServer.router.Logger.Fatal("$PORT must be set")
 	}
 
+	shutdownTracing := configTracing()
 	configDatabase()
 	setMiddlewares()
 	setRoutes()
-	appServer.router.Logger.Fatal(appServer.router.Start(":" + port))
+	startMetricsServer()
+	startJobs()
+
+	go func() {
+		if err := appServer.router.Start(":" + port); err != nil && err != http.ErrServerClosed {
+			appServer.router.Logger.Fatal(err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM the requests in flight finish and the pending spans are sent
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := appServer.router.Shutdown(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
 }
 
 func configServer() {
 	appServer.router = echo.New()
 	appServer.logger = appServer.router.Logger
+	appServer.router.HTTPErrorHandler = httpErrorHandler
+	configLogger()
+	appServer.secret = jwtSecret()
 }
 
-func configDatabase() {
-	var uri string
+// jwtSecret reads the key tokens are signed with from $JWT_SECRET. Anyone knowing it can sign
+// in as any user, the previous fixed key is only kept so existing deployments keep working
+func jwtSecret() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		appServer.logger.Warn("$JWT_SECRET is not set, using the default key")
+		return []byte(defaultJWTSecret)
+	}
+	return []byte(secret)
+}
+
+func configTracing() func(context.Context) error {
+	shutdown, err := tracing.Init()
+	if err != nil {
+		appServer.logger.Fatal(err)
+	}
+	return shutdown
+}
+
+func mongoURI() string {
 	password := os.Getenv("MONGO_PASSWORD")
 	if password == "" {
 		// Connecting to local machine mongo instance
-		uri = "mongodb://localhost:27017"
-	} else {
-		// Connecting to Atlas mongo instance
-		uri = "mongodb+srv://pf-server:" + password + "@cluster0.7ihuj.mongodb.net/apis_pf_db?retryWrites=true&w=majority"
+		return "mongodb://localhost:27017"
 	}
+	// Connecting to Atlas mongo instance
+	return "mongodb+srv://pf-server:" + password + "@cluster0.7ihuj.mongodb.net/apis_pf_db?retryWrites=true&w=majority"
+}
 
-	database, err := datastore.NewDatastore(uri, appServer.logger)
+func configDatabase() {
+	database, err := datastore.NewDatastore(mongoURI(), appServer.logger)
 	if err != nil {
 		appServer.logger.Fatal(err)
 	}
@@ -64,13 +134,86 @@ func configDatabase() {
 }
 
 func setMiddlewares() {
-	appServer.router.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "method=${method}, uri=${uri}, status=${status}, latency=${latency_human}\n",
-	}))
+	appServer.router.Use(tracing.Middleware())
+	appServer.router.Use(middleware.RequestID())
+	appServer.router.Use(requestMetrics())
+	appServer.router.Use(requestLogger())
 	appServer.router.Use(middleware.CORSWithConfig(
 		middleware.CORSConfig{
 			AllowOrigins:     []string{"http://localhost:3000"},
 			AllowMethods:     []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodPatch},
 			AllowCredentials: true,
 		}))
+	appServer.router.Use(requestDeadline(requestTimeout(), routeTimeouts))
+}
+
+// requestMetrics records the count and latency of every request by route.
+// It must be registered before requestLogger, which handles the error and sets the final status
+func requestMetrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := strconv.Itoa(c.Response().Status)
+			metrics.ObserveRequest(c.Request().Method, route, status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// startMetricsServer serves the metrics on $METRICS_ADDR, apart from the public API so
+// they can only be scraped from the internal network
+func startMetricsServer() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		addr = defaultMetricsAddr
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			appServer.logger.Error(err)
+		}
+	}()
+}
+
+// requestTimeout reads the per-request deadline from $REQUEST_TIMEOUT (e.g. "15s")
+func requestTimeout() time.Duration {
+	value := os.Getenv("REQUEST_TIMEOUT")
+	if value == "" {
+		return defaultRequestTimeout
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		appServer.logger.Warnf("Invalid $REQUEST_TIMEOUT %q, using %s", value, defaultRequestTimeout)
+		return defaultRequestTimeout
+	}
+	return timeout
+}
+
+// requestDeadline attaches a deadline to the request context so that store
+// operations are cancelled when the client disconnects or the time runs out.
+// Routes in longer get their own deadline when it is longer than timeout
+func requestDeadline(timeout time.Duration, longer map[string]time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			deadline := timeout
+			if routeTimeout := longer[c.Path()]; routeTimeout > deadline {
+				deadline = routeTimeout
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), deadline)
+			defer cancel()
+
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
 }
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	e := echo.New()
+	e.Use(requestDeadline(time.Second, map[string]time.Duration{"/upload": time.Minute}))
+
+	remaining := map[string]time.Duration{}
+	handler := func(c echo.Context) error {
+		deadline, ok := c.Request().Context().Deadline()
+		if !ok {
+			t.Errorf("%s has no deadline", c.Path())
+		}
+		remaining[c.Path()] = time.Until(deadline)
+		return c.NoContent(http.StatusOK)
+	}
+	e.GET("/projects", handler)
+	e.POST("/upload", handler)
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/projects", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/upload", nil))
+
+	if remaining["/projects"] > time.Second {
+		t.Errorf("/projects deadline in %s, want at most the request timeout", remaining["/projects"])
+	}
+	if remaining["/upload"] <= time.Second {
+		t.Errorf("/upload deadline in %s, want the longer upload timeout", remaining["/upload"])
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = httpErrorHandler
+	e.Use(middleware.RequestID())
+	e.GET("/projects/:id", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "Can't find project")
+	})
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/projects/1", nil))
+
+	var body map[string]string
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error body should be JSON, got %q", recorder.Body.String())
+	}
+	if recorder.Code != http.StatusNotFound || body["message"] != "Can't find project" {
+		t.Errorf("Response = %d %v", recorder.Code, body)
+	}
+	if id := recorder.Header().Get(echo.HeaderXRequestID); id == "" || body["request_id"] != id {
+		t.Errorf("Error body request_id = %q, want the %q header", body["request_id"], id)
+	}
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/datastore"
+	"github.com/jpr98/apis_pf_back/models"
+)
+
+// RunCommand runs a maintenance command by name instead of starting the web server
+func RunCommand(name string) {
+	configServer()
+
+	database, err := datastore.NewDatastore(mongoURI(), appServer.logger)
+	if err != nil {
+		appServer.logger.Fatal(err)
+	}
+	appServer.database = database
+
+	switch name {
+	case "repair-votes":
+		repairVotes()
+	case "rebuild-tags":
+		rebuildTags()
+	case "migrate-campaigns":
+		migrateCampaigns()
+	case "migrate-slugs":
+		migrateSlugs()
+	case "migrate-categories":
+		migrateCategories()
+	default:
+		appServer.logger.Fatalf("Unknown command %q", name)
+	}
+}
+
+// repairVotes recomputes votes_count for every project and reports the ones that were out of sync
+func repairVotes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	projectStore := models.NewProjectStore(appServer.database.DB)
+	discrepancies, err := projectStore.RepairVotesCount(ctx)
+	if err != nil {
+		appServer.logger.Fatal(err)
+	}
+
+	for _, d := range discrepancies {
+		fmt.Fprintf(os.Stdout, "project=%s title=%q votes_count=%d votes=%d\n", d.ProjectID.Hex(), d.Title, d.Stored, d.Actual)
+	}
+	fmt.Fprintf(os.Stdout, "%d projects repaired\n", len(discrepancies))
+}
+
+// rebuildTags recomputes the tag usage counts used by the tag suggestions
+func rebuildTags() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	projectStore := models.NewProjectStore(appServer.database.DB)
+	if err := projectStore.RebuildTagUsage(ctx); err != nil {
+		appServer.logger.Fatal(err)
+	}
+	fmt.Fprintln(os.Stdout, "Tag usage rebuilt")
+}
+
+// migrateCampaigns sets the status, dates and funding of projects created before campaigns existed
+func migrateCampaigns() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	projectStore := models.NewProjectStore(appServer.database.DB)
+	migrated, err := projectStore.MigrateCampaigns(ctx)
+	if err != nil {
+		appServer.logger.Fatal(err)
+	}
+	fmt.Fprintf(os.Stdout, "%d projects migrated\n", migrated)
+}
+
+// migrateSlugs gives a slug to the projects created before projects had one
+func migrateSlugs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	projectStore := models.NewProjectStore(appServer.database.DB)
+	migrated, err := projectStore.MigrateSlugs(ctx)
+	if err != nil {
+		appServer.logger.Fatal(err)
+	}
+	fmt.Fprintf(os.Stdout, "%d projects migrated\n", migrated)
+}
+
+// migrateCategories creates the categories used by existing projects and moves the projects to them
+func migrateCategories() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	projectStore := models.NewProjectStore(appServer.database.DB)
+	migrated, skipped, err := projectStore.MigrateCategories(ctx)
+	if err != nil {
+		appServer.logger.Fatal(err)
+	}
+	for _, name := range skipped {
+		fmt.Fprintf(os.Stderr, "Skipped category %q, it has no valid slug\n", name)
+	}
+	fmt.Fprintf(os.Stdout, "%d projects migrated\n", migrated)
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/jobs"
+	"github.com/jpr98/apis_pf_back/models"
+)
+
+const (
+	// defaultCloseInterval is used when $CAMPAIGN_CLOSE_INTERVAL is not set
+	defaultCloseInterval = time.Minute
+	// defaultRestoreWindow is used when $PROJECT_RESTORE_WINDOW is not set
+	defaultRestoreWindow = 30 * 24 * time.Hour
+)
+
+// startJobs starts the background job scheduler unless $JOBS_DISABLED is true
+func startJobs() {
+	if disabled, _ := strconv.ParseBool(os.Getenv("JOBS_DISABLED")); disabled {
+		return
+	}
+
+	projectStore := models.NewProjectStore(appServer.database.DB)
+	notificationStore := models.NewNotificationStore(appServer.database.DB)
+
+	scheduler := jobs.NewScheduler(models.NewJobStore(appServer.database.DB), appServer.logger)
+	scheduler.Register(jobs.CloseCampaigns(projectStore, notificationStore, closeInterval()))
+	scheduler.Register(jobs.PublishScheduled(projectStore, notificationStore, time.Minute))
+	scheduler.Register(jobs.RepairVotes(projectStore, 24*time.Hour))
+	scheduler.Register(jobs.RebuildTags(projectStore, 24*time.Hour))
+	scheduler.Register(jobs.PurgeDeleted(projectStore, restoreWindow(), time.Hour))
+	scheduler.Register(jobs.RefreshTrending(projectStore, 15*time.Minute))
+	scheduler.Register(jobs.RefreshRecommendations(models.NewRecommendationStore(appServer.database.DB), 6*time.Hour))
+	scheduler.Start(context.Background())
+}
+
+// closeInterval reads how often ended campaigns are closed from $CAMPAIGN_CLOSE_INTERVAL (e.g. "5m")
+func closeInterval() time.Duration {
+	value := os.Getenv("CAMPAIGN_CLOSE_INTERVAL")
+	if value == "" {
+		return defaultCloseInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		appServer.logger.Warnf("Invalid $CAMPAIGN_CLOSE_INTERVAL %q, using %s", value, defaultCloseInterval)
+		return defaultCloseInterval
+	}
+	return interval
+}
+
+// restoreWindow reads how long deleted projects can be restored from $PROJECT_RESTORE_WINDOW (e.g. "168h"),
+// they are purged afterwards
+func restoreWindow() time.Duration {
+	value := os.Getenv("PROJECT_RESTORE_WINDOW")
+	if value == "" {
+		return defaultRestoreWindow
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		appServer.logger.Warnf("Invalid $PROJECT_RESTORE_WINDOW %q, using %s", value, defaultRestoreWindow)
+		return defaultRestoreWindow
+	}
+	return window
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/controllers"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// configLogger sets the server log level from $LOG_LEVEL (debug, info, warn, error, off)
+func configLogger() {
+	var level log.Lvl
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = log.DEBUG
+	case "warn":
+		level = log.WARN
+	case "error":
+		level = log.ERROR
+	case "off":
+		level = log.OFF
+	default:
+		level = log.INFO
+	}
+	appServer.logger.SetLevel(level)
+}
+
+// requestLogger writes a structured JSON entry for every request
+func requestLogger() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			req := c.Request()
+			res := c.Response()
+			fields := controllers.RequestFields(c)
+			fields["method"] = req.Method
+			fields["uri"] = req.RequestURI
+			fields["route"] = c.Path()
+			fields["status"] = res.Status
+			fields["latency"] = time.Since(start).String()
+			fields["remote_ip"] = c.RealIP()
+			fields["bytes_out"] = res.Size
+			if err != nil {
+				fields["error"] = err.Error()
+			}
+
+			switch {
+			case res.Status >= http.StatusInternalServerError:
+				appServer.logger.Errorj(fields)
+			case res.Status >= http.StatusBadRequest:
+				appServer.logger.Warnj(fields)
+			default:
+				appServer.logger.Infoj(fields)
+			}
+			return nil
+		}
+	}
+}
+
+// httpErrorHandler sends echo errors as JSON including the request id
+func httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	he, ok := err.(*echo.HTTPError)
+	if !ok {
+		he = echo.NewHTTPError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(he.Code)
+	} else {
+		err = c.JSON(he.Code, map[string]interface{}{
+			"message":    he.Message,
+			"request_id": c.Response().Header().Get(echo.HeaderXRequestID),
+		})
+	}
+	if err != nil {
+		appServer.logger.Error(err)
+	}
+}
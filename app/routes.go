@@ -1,50 +1,183 @@
 package app
 
 import (
+	"context"
+	"time"
+
 	"github.com/jpr98/apis_pf_back/controllers"
 	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 func setRoutes() {
 	setUserRoutes()
 	setProjectRoutes()
+	setTagRoutes()
+	setCategoryRoutes()
+	setCollectionRoutes()
 	setUploadsRoutes()
+	setNotificationRoutes()
+	setAdminRoutes()
 }
 
 func setUserRoutes() {
 	userStore := models.NewUserStore(appServer.database.DB)
-	usersController := controllers.NewUsersController(*userStore)
+	usersController := controllers.NewUsersController(*userStore, appServer.secret)
 
 	appServer.router.POST("/signup", usersController.Create)
 	appServer.router.POST("/login", usersController.Login)
 	appServer.router.GET("/validate/:token", usersController.ValidateToken)
 
 	u := appServer.router.Group("/users")
-	u.Use(middleware.JWT([]byte("secret")))
+	u.Use(middleware.JWT(appServer.secret))
 	u.GET("/:id", usersController.GetByID)
 	u.PATCH("/:id", usersController.Update)
+
+	recommendationsController := controllers.NewRecommendationsController(*models.NewRecommendationStore(appServer.database.DB), *userStore)
+	u.GET("/:id/recommendations", recommendationsController.GetByUser)
 }
 
 func setProjectRoutes() {
 	projectStore := models.NewProjectStore(appServer.database.DB)
-	projectsController := controllers.NewProjectsController(*projectStore)
+	userStore := models.NewUserStore(appServer.database.DB)
+	projectsController := controllers.NewProjectsController(*projectStore, *userStore, restoreWindow())
 
-	appServer.router.GET("projects/:id", projectsController.GetByID)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := projectStore.CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+	if err := models.NewActivityStore(appServer.database.DB).CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+
+	// GET /projects/:id resolves slugs itself to redirect old ones, the rest of the routes take
+	// a slug in place of the id
+	resolveProject := controllers.ResolveProject(*projectStore)
+	optionalAuth := controllers.OptionalJWT(appServer.secret)
+	appServer.router.GET("projects/:id", projectsController.GetByID, optionalAuth)
 	appServer.router.POST("/projects/search", projectsController.SearchProject)
-	appServer.router.GET("/projects/owned/:userId", projectsController.GetByOwner)
+	appServer.router.GET("/projects/suggest", projectsController.Suggest)
+	appServer.router.GET("/projects/trending", projectsController.GetTrending)
+	appServer.router.GET("/projects/owned/:userId", projectsController.GetByOwner, optionalAuth)
 	appServer.router.GET("/projects/voted/:userId", projectsController.GetVotedFor)
 	appServer.router.GET("/projects/contributed/:userId", projectsController.GetContributedTo)
-	appServer.router.POST("/projects/:id/metrics/view", projectsController.View)
+	appServer.router.POST("/projects/:id/metrics/view", projectsController.View, resolveProject)
 
 	p := appServer.router.Group("/projects")
-	p.Use(middleware.JWT([]byte("secret")))
+	p.Use(middleware.JWT(appServer.secret), resolveProject)
 	p.POST("/new", projectsController.Create)
 	p.PATCH("/:id", projectsController.Update)
 	p.POST("/:id/vote", projectsController.VoteForProject)
 	p.DELETE("/:id", projectsController.Delete)
+	p.GET("/deleted", projectsController.GetDeleted)
+	p.POST("/:id/restore", projectsController.Restore)
 	p.POST("/:id/comment", projectsController.Comment)
 	p.POST("/:id/contribute", projectsController.Contribute)
+	p.POST("/:id/publish", projectsController.Publish)
+	p.DELETE("/:id/publish", projectsController.Unschedule)
+	p.POST("/:id/cancel", projectsController.Cancel)
+	p.POST("/:id/rewards", projectsController.AddReward)
+	p.PATCH("/:id/rewards/:rewardId", projectsController.UpdateReward)
+	p.DELETE("/:id/rewards/:rewardId", projectsController.RemoveReward)
+	p.GET("/:id/rewards/:rewardId/backers", projectsController.GetRewardBackers)
+
+	p.GET("/:id/analytics", projectsController.GetAnalytics)
+
+	teamController := controllers.NewTeamController(*projectStore, *models.NewNotificationStore(appServer.database.DB), *userStore)
+	p.POST("/:id/team", teamController.Invite)
+	p.POST("/:id/team/accept", teamController.Accept)
+	p.DELETE("/:id/team/:userId", teamController.Remove)
+	p.GET("/:id/ownership", teamController.GetOwnership)
+	p.POST("/:id/transfer", teamController.ProposeTransfer)
+	p.POST("/:id/transfer/accept", teamController.AcceptTransfer)
+	p.DELETE("/:id/transfer", teamController.CancelTransfer)
+
+	setUpdateRoutes(projectStore, userStore, optionalAuth, resolveProject)
+	setRevisionRoutes(projectStore, userStore, p)
+}
+
+func setUpdateRoutes(projectStore *models.ProjectStore, userStore *models.UserStore, optionalAuth, resolveProject echo.MiddlewareFunc) {
+	updateStore := models.NewUpdateStore(appServer.database.DB)
+	notificationStore := models.NewNotificationStore(appServer.database.DB)
+	updatesController := controllers.NewUpdatesController(*updateStore, *projectStore, *notificationStore, *userStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := updateStore.CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+
+	appServer.router.GET("/projects/:id/updates", updatesController.GetFeed, optionalAuth, resolveProject)
+	appServer.router.GET("/projects/:id/updates/:updateId", updatesController.GetByID, optionalAuth, resolveProject)
+
+	// The JWT middleware is set per route, a group would also catch the public feed routes
+	auth := middleware.JWT(appServer.secret)
+	appServer.router.POST("/projects/:id/updates", updatesController.Create, auth, resolveProject)
+	appServer.router.PATCH("/projects/:id/updates/:updateId", updatesController.Edit, auth, resolveProject)
+	appServer.router.DELETE("/projects/:id/updates/:updateId", updatesController.Delete, auth, resolveProject)
+}
+
+func setRevisionRoutes(projectStore *models.ProjectStore, userStore *models.UserStore, p *echo.Group) {
+	revisionStore := models.NewRevisionStore(appServer.database.DB)
+	revisionsController := controllers.NewRevisionsController(*revisionStore, *projectStore, *userStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := revisionStore.CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+
+	p.GET("/:id/revisions", revisionsController.GetByProject)
+	p.POST("/:id/revisions/:revisionId/restore", revisionsController.Restore)
+}
+
+func setTagRoutes() {
+	tagStore := models.NewTagStore(appServer.database.DB)
+	tagsController := controllers.NewTagsController(*tagStore)
+
+	appServer.router.GET("/tags/suggest", tagsController.Suggest)
+}
+
+func setCategoryRoutes() {
+	categoryStore := models.NewCategoryStore(appServer.database.DB)
+	categoriesController := controllers.NewCategoriesController(*categoryStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := categoryStore.CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+
+	appServer.router.GET("/categories", categoriesController.GetAll)
+
+	a := appServer.router.Group("/admin/categories")
+	a.Use(adminAuth()...)
+	a.POST("", categoriesController.Create)
+	a.PUT("/:slug", categoriesController.Update)
+	a.DELETE("/:slug", categoriesController.Delete)
+}
+
+func setCollectionRoutes() {
+	curationStore := models.NewCurationStore(appServer.database.DB)
+	collectionsController := controllers.NewCollectionsController(*curationStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := curationStore.CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+
+	appServer.router.GET("/collections", collectionsController.GetShowing)
+	appServer.router.GET("/collections/:slug/projects", collectionsController.GetProjects)
+
+	a := appServer.router.Group("/admin/collections")
+	a.Use(adminAuth()...)
+	a.GET("", collectionsController.GetAll)
+	a.POST("", collectionsController.Create)
+	a.PUT("/:id", collectionsController.Update)
+	a.DELETE("/:id", collectionsController.Delete)
 }
 
 func setUploadsRoutes() {
@@ -52,3 +185,40 @@ func setUploadsRoutes() {
 
 	appServer.router.POST("/upload", uploadsController.Upload)
 }
+
+func setNotificationRoutes() {
+	notificationStore := models.NewNotificationStore(appServer.database.DB)
+	notificationsController := controllers.NewNotificationsController(*notificationStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := notificationStore.CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+
+	n := appServer.router.Group("/notifications")
+	n.Use(middleware.JWT(appServer.secret))
+	n.GET("", notificationsController.GetMine)
+	n.POST("/read", notificationsController.MarkRead)
+}
+
+func setAdminRoutes() {
+	jobStore := models.NewJobStore(appServer.database.DB)
+	jobsController := controllers.NewJobsController(*jobStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := jobStore.CreateIndexes(ctx); err != nil {
+		appServer.logger.Error(err)
+	}
+
+	a := appServer.router.Group("/admin")
+	a.Use(adminAuth()...)
+	a.GET("/jobs/runs", jobsController.GetRuns)
+}
+
+// adminAuth authenticates the request and checks the user is an admin
+func adminAuth() []echo.MiddlewareFunc {
+	userStore := models.NewUserStore(appServer.database.DB)
+	return []echo.MiddlewareFunc{middleware.JWT(appServer.secret), controllers.RequireAdmin(*userStore)}
+}
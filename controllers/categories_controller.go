@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Categories represents a project categories controller
+type Categories struct {
+	categoryStore models.CategoryStore
+}
+
+// NewCategoriesController creates a new categories controller with a store
+func NewCategoriesController(cs models.CategoryStore) Categories {
+	return Categories{categoryStore: cs}
+}
+
+// GetAll returns every category with its number of projects, named in the lang query parameter
+func (ct *Categories) GetAll(c echo.Context) error {
+	language := c.QueryParam("lang")
+	if language == "" {
+		language = models.DefaultLanguage
+	}
+
+	categories, err := ct.categoryStore.GetAll(c.Request().Context(), language)
+	if err != nil {
+		logError(c, "Can't get categories", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't get categories")
+	}
+
+	return c.JSON(http.StatusOK, categories)
+}
+
+// Create adds a category
+func (ct *Categories) Create(c echo.Context) error {
+	category := new(models.Category)
+	if err := c.Bind(category); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind request body")
+	}
+
+	if err := category.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	err := ct.categoryStore.Create(c.Request().Context(), *category)
+	if err == models.ErrCategoryExists {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't create category", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, category)
+}
+
+// Update replaces a category, its slug can't change since projects refer to it
+func (ct *Categories) Update(c echo.Context) error {
+	category := new(models.Category)
+	if err := c.Bind(category); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind request body")
+	}
+
+	category.Slug = c.Param("slug")
+	if err := category.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	err := ct.categoryStore.Update(c.Request().Context(), *category)
+	if err == models.ErrCategoryNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't update category", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, category)
+}
+
+// Delete removes a category without projects or subcategories
+func (ct *Categories) Delete(c echo.Context) error {
+	err := ct.categoryStore.Delete(c.Request().Context(), c.Param("slug"))
+	switch {
+	case err == models.ErrCategoryNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case err == models.ErrCategoryInUse:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case err != nil:
+		logError(c, "Can't delete category", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Category deleted")
+}
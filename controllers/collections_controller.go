@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Collections represents a curated project collections controller
+type Collections struct {
+	curationStore models.CurationStore
+}
+
+// NewCollectionsController creates a new collections controller with a store
+func NewCollectionsController(cs models.CurationStore) Collections {
+	return Collections{curationStore: cs}
+}
+
+// GetShowing returns the collections showing now, in order
+func (cl *Collections) GetShowing(c echo.Context) error {
+	collections, err := cl.curationStore.GetAll(c.Request().Context(), time.Now(), false)
+	if err != nil {
+		logError(c, "Can't get collections", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't get collections")
+	}
+
+	return c.JSON(http.StatusOK, collections)
+}
+
+// GetAll returns every collection, including the ones scheduled or already ended
+func (cl *Collections) GetAll(c echo.Context) error {
+	collections, err := cl.curationStore.GetAll(c.Request().Context(), time.Now(), true)
+	if err != nil {
+		logError(c, "Can't get collections", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't get collections")
+	}
+
+	return c.JSON(http.StatusOK, collections)
+}
+
+// GetProjects returns a page of the projects of a collection showing now, in the collection order
+func (cl *Collections) GetProjects(c echo.Context) error {
+	page, err := getPage(c)
+	if err != nil {
+		return err
+	}
+
+	projects, err := cl.curationStore.GetProjects(c.Request().Context(), c.Param("slug"), time.Now(), page)
+	if err == models.ErrCollectionNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't get collection projects", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return sendProjectPage(c, http.StatusOK, projects)
+}
+
+// Create adds a collection
+func (cl *Collections) Create(c echo.Context) error {
+	collection := new(models.EditCollection)
+	if err := c.Bind(collection); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind request body")
+	}
+
+	if err := collection.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	created, err := cl.curationStore.Create(c.Request().Context(), *collection)
+	if err == models.ErrCollectionExists {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't create collection", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, created)
+}
+
+// Update replaces a collection
+func (cl *Collections) Update(c echo.Context) error {
+	collection := new(models.EditCollection)
+	if err := c.Bind(collection); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind request body")
+	}
+
+	if err := collection.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	updated, err := cl.curationStore.Update(c.Request().Context(), c.Param("id"), *collection)
+	switch {
+	case err == models.ErrCollectionNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case err == models.ErrCollectionExists:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case err != nil:
+		logError(c, "Can't update collection", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// Delete removes a collection
+func (cl *Collections) Delete(c echo.Context) error {
+	err := cl.curationStore.Delete(c.Request().Context(), c.Param("id"))
+	if err == models.ErrCollectionNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't delete collection", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Collection deleted")
+}
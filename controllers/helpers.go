@@ -1,8 +1,16 @@
 package controllers
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/dgrijalva/jwt-go"
+	"github.com/jpr98/apis_pf_back/models"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
 )
 
 func getTokenStringClaimByKey(c echo.Context, key string) string {
@@ -17,3 +25,216 @@ func getTokenStringClaimByKey(c echo.Context, key string) string {
 	}
 	return value
 }
+
+// hmacKey returns the key of tokens signed with the HMAC secret and rejects any other signing
+// method, like the JWT middleware does
+func hmacKey(secret []byte) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+		}
+		return secret, nil
+	}
+}
+
+// OptionalJWT authenticates requests that carry a valid bearer token and lets the rest through
+// as anonymous, for public routes that show more to some users
+func OptionalJWT(secret []byte) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			if strings.HasPrefix(auth, "Bearer ") {
+				token, err := jwt.Parse(strings.TrimPrefix(auth, "Bearer "), hmacKey(secret))
+				if err == nil && token.Valid {
+					c.Set("user", token)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireAdmin rejects the requests of users that are not admins, it must run after the JWT middleware.
+// The role is checked in the store instead of the token so demoted admins lose access right away
+func RequireAdmin(us models.UserStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			admin, err := us.IsAdmin(c.Request().Context(), getTokenStringClaimByKey(c, "id"))
+			if err != nil {
+				logError(c, "Can't check user role", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Can't check user role")
+			}
+			if !admin {
+				return echo.NewHTTPError(http.StatusForbidden, "You must be an admin")
+			}
+			return next(c)
+		}
+	}
+}
+
+// ResolveProject replaces a slug in the id param with the id of its project, so every project
+// route takes slugs like GET /projects/:id does. Unknown slugs are left for the handler to reject
+func ResolveProject(ps models.ProjectStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Param("id")
+			if key == "" {
+				return next(c)
+			}
+
+			id, err := ps.ResolveID(c.Request().Context(), key)
+			if err != nil || id == key {
+				return next(c)
+			}
+
+			values := c.ParamValues()
+			for index, name := range c.ParamNames() {
+				if name == "id" {
+					values[index] = id
+				}
+			}
+			c.SetParamValues(values...)
+			return next(c)
+		}
+	}
+}
+
+// isAdmin checks in the store if the authenticated user is an admin, like RequireAdmin, so
+// demoted admins lose access right away. Errors are logged and the user is taken as not an admin
+func isAdmin(c echo.Context, us *models.UserStore) bool {
+	userID := getTokenStringClaimByKey(c, "id")
+	if userID == "" {
+		return false
+	}
+
+	admin, err := us.IsAdmin(c.Request().Context(), userID)
+	if err != nil {
+		logError(c, "Can't check user role", err)
+	}
+	return admin
+}
+
+// RequestFields returns the request id and, when authenticated, the user id of a request as log fields
+func RequestFields(c echo.Context) log.JSON {
+	fields := log.JSON{"request_id": c.Response().Header().Get(echo.HeaderXRequestID)}
+	if userID := getTokenStringClaimByKey(c, "id"); userID != "" {
+		fields["user_id"] = userID
+	}
+	return fields
+}
+
+func logError(c echo.Context, message string, err error) {
+	fields := RequestFields(c)
+	fields["message"] = message
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	c.Logger().Errorj(fields)
+}
+
+// getProjectWithRole finds the project in the id param and checks that the user has at least role in its team
+func getProjectWithRole(c echo.Context, ps *models.ProjectStore, role, action string) (models.Project, error) {
+	project, err := ps.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		logError(c, "Can't find project", err)
+		return models.Project{}, echo.NewHTTPError(http.StatusNotFound, "Can't find project")
+	}
+
+	if !project.HasRole(getTokenStringClaimByKey(c, "id"), role) {
+		return models.Project{}, echo.NewHTTPError(http.StatusForbidden, "You must be a project "+role+" to "+action)
+	}
+
+	return project, nil
+}
+
+// mergePatchMIME is the content type of JSON Merge Patch bodies
+const mergePatchMIME = "application/merge-patch+json"
+
+// readPatch parses the body of a PATCH request with parse. A version in the If-Match
+// header takes precedence over one in the body, conditional reports if it was used
+func readPatch(c echo.Context, parse func([]byte) (models.Patch, error)) (patch models.Patch, conditional bool, err error) {
+	mime := strings.TrimSpace(strings.Split(c.Request().Header.Get(echo.HeaderContentType), ";")[0])
+	if mime != echo.MIMEApplicationJSON && mime != mergePatchMIME {
+		return patch, false, echo.NewHTTPError(http.StatusUnsupportedMediaType, "Use "+echo.MIMEApplicationJSON+" or "+mergePatchMIME)
+	}
+
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		logError(c, "Can't read request body", err)
+		return patch, false, echo.NewHTTPError(http.StatusBadRequest, "Can't read request body")
+	}
+
+	patch, err = parse(body)
+	if err != nil {
+		return patch, false, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	match := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		return patch, false, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(match, "W/"), `"`), 10, 64)
+	if err != nil {
+		return patch, true, echo.NewHTTPError(http.StatusPreconditionFailed, "Unknown ETag in If-Match")
+	}
+	patch.Version = &version
+	return patch, true, nil
+}
+
+// patchConflict responds to a patch that lost against a concurrent edit, with 412 when
+// the version came from If-Match and 409 when it came in the body
+func patchConflict(c echo.Context, conditional bool) error {
+	if conditional {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, models.ErrVersionConflict.Error())
+	}
+	return echo.NewHTTPError(http.StatusConflict, models.ErrVersionConflict.Error())
+}
+
+// setETag sets the ETag header of a versioned document
+func setETag(c echo.Context, version int64) {
+	c.Response().Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// getPage reads the limit, cursor and count query parameters of a listing
+func getPage(c echo.Context) (models.Page, error) {
+	page := models.Page{Cursor: c.QueryParam("cursor")}
+	if page.Cursor != "" && !models.ValidCursor(page.Cursor) {
+		return page, echo.NewHTTPError(http.StatusBadRequest, models.ErrInvalidCursor.Error())
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		value, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || value < 1 {
+			return page, echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		page.Limit = value
+	}
+
+	if count := c.QueryParam("count"); count != "" {
+		value, err := strconv.ParseBool(count)
+		if err != nil {
+			return page, echo.NewHTTPError(http.StatusBadRequest, "Invalid count")
+		}
+		page.Count = value
+	}
+
+	return page, nil
+}
+
+// setNextPageLink sets the Link header pointing to the page after cursor, if any
+func setNextPageLink(c echo.Context, cursor string) {
+	if cursor == "" {
+		return
+	}
+	next := *c.Request().URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+	c.Response().Header().Set("Link", "<"+next.String()+">; rel=\"next\"")
+}
+
+// sendProjectPage responds with a page of projects and a Link header to the next page
+func sendProjectPage(c echo.Context, status int, page models.ProjectPage) error {
+	setNextPageLink(c, page.NextCursor)
+	return c.JSON(status, page)
+}
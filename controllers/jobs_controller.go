@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Jobs represents a scheduled jobs controller
+type Jobs struct {
+	jobStore models.JobStore
+}
+
+// NewJobsController creates a new jobs controller with a store
+func NewJobsController(js models.JobStore) Jobs {
+	return Jobs{jobStore: js}
+}
+
+// GetRuns returns the latest runs of the scheduled jobs, optionally of a single job
+func (j *Jobs) GetRuns(c echo.Context) error {
+	limit := int64(models.DefaultPageLimit)
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > models.MaxPageLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		limit = parsed
+	}
+
+	runs, err := j.jobStore.GetRuns(c.Request().Context(), c.QueryParam("job"), limit)
+	if err != nil {
+		logError(c, "Can't get job runs", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, runs)
+}
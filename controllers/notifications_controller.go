@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Notifications represents a notifications controller
+type Notifications struct {
+	notificationStore models.NotificationStore
+}
+
+// NewNotificationsController creates a new notifications controller with a store
+func NewNotificationsController(ns models.NotificationStore) Notifications {
+	return Notifications{notificationStore: ns}
+}
+
+// GetMine returns the latest notifications of the authenticated user
+func (n *Notifications) GetMine(c echo.Context) error {
+	userID := getTokenStringClaimByKey(c, "id")
+
+	notifications, err := n.notificationStore.GetByUser(c.Request().Context(), userID, models.MaxPageLimit)
+	if err != nil {
+		logError(c, "Can't get notifications", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, notifications)
+}
+
+// MarkRead marks the notifications of the authenticated user as read
+func (n *Notifications) MarkRead(c echo.Context) error {
+	userID := getTokenStringClaimByKey(c, "id")
+
+	if err := n.notificationStore.MarkRead(c.Request().Context(), userID); err != nil {
+		logError(c, "Can't mark notifications as read", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Notifications marked as read")
+}
@@ -3,161 +3,239 @@ package controllers
 import (
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 
+	"github.com/jpr98/apis_pf_back/metrics"
 	"github.com/jpr98/apis_pf_back/models"
 	"github.com/labstack/echo/v4"
 )
 
 // Projects represents a projects controller
 type Projects struct {
-	projectStore models.ProjectStore
+	projectStore  models.ProjectStore
+	userStore     models.UserStore
+	restoreWindow time.Duration
 }
 
-// NewProjectsController creates a new projects controlelr with a store
-func NewProjectsController(ps models.ProjectStore) Projects {
-	return Projects{projectStore: ps}
+// NewProjectsController creates a new projects controlelr with its stores and the time
+// deleted projects can be restored for
+func NewProjectsController(ps models.ProjectStore, us models.UserStore, restoreWindow time.Duration) Projects {
+	return Projects{projectStore: ps, userStore: us, restoreWindow: restoreWindow}
 }
 
 // Create handles creating a new project
 func (p *Projects) Create(c echo.Context) error {
 	project := new(models.Project)
 	if err := c.Bind(project); err != nil {
-		c.Logger().Error("Can't bind body to JSON")
-		return c.String(http.StatusBadRequest, "Can't bind body to json")
+		logError(c, "Can't bind body to JSON", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind body to json")
+	}
+
+	if err := project.ValidateRewards(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if project.Goal < 0 {
+		// Drafts may have no goal yet, it is required to publish them
+		return echo.NewHTTPError(http.StatusBadRequest, "Goal must be greater than zero")
+	}
+	if project.Geo != nil {
+		if err := project.Geo.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 	}
 
 	userID := getTokenStringClaimByKey(c, "id")
-	createdProject, err := p.projectStore.Create(*project, userID)
+	createdProject, err := p.projectStore.Create(c.Request().Context(), *project, userID)
+	if err == models.ErrUnknownCategory {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
-		c.Logger().Errorf("Can't create project", err)
-		return c.String(http.StatusInternalServerError, "Can't create project")
+		logError(c, "Can't create project", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't create project")
 	}
 
+	metrics.Event(metrics.ProjectCreate)
 	return c.JSON(http.StatusCreated, createdProject)
 }
 
-// Update updates a project
+// Update applies a partial update to a project, only the fields in the body are changed
+// and fields set to null are cleared
 func (p *Projects) Update(c echo.Context) error {
-	ep := new(models.EditProject)
-	if err := c.Bind(ep); err != nil {
-		return c.String(http.StatusBadRequest, "Can't bind body to json")
-	}
-
-	id := c.Param("id")
-	project, err := p.projectStore.GetByID(id)
+	patch, conditional, err := readPatch(c, models.ParseProjectPatch)
 	if err != nil {
-		return c.String(http.StatusNotFound, "No projects with matching id")
+		return err
 	}
 
-	if getTokenStringClaimByKey(c, "id") != project.Owner.Hex() {
-		return c.String(http.StatusForbidden, "You can only update projects you own")
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleEditor, "update it"); err != nil {
+		return err
 	}
 
-	if err := p.projectStore.Update(project, *ep); err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
+	userID := getTokenStringClaimByKey(c, "id")
+	project, err := p.projectStore.Patch(c.Request().Context(), c.Param("id"), userID, patch)
+	if err == models.ErrVersionConflict {
+		return patchConflict(c, conditional)
+	}
+	if err == models.ErrUnknownCategory {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't update project", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, "Updated")
+	setETag(c, project.Version)
+	return c.JSON(http.StatusOK, project)
 }
 
-// GetByID handles looking for a project with a given id
+// GetByID handles looking for a project with a given id or slug, old slugs redirect to the current one
 func (p *Projects) GetByID(c echo.Context) error {
-	id := c.Param("id")
-	project, err := p.projectStore.GetByID(id)
+	key := c.Param("id")
+	project, err := p.projectStore.GetBySlugOrID(c.Request().Context(), key)
 	if err != nil {
-		c.Logger().Errorf("Can't find project", err)
-		return c.String(http.StatusNotFound, "Can't find project")
+		logError(c, "Can't find project", err)
+		return echo.NewHTTPError(http.StatusNotFound, "Can't find project")
+	}
+	userID := getTokenStringClaimByKey(c, "id")
+	if !project.CanSee(userID, false) && !isAdmin(c, &p.userStore) {
+		return echo.NewHTTPError(http.StatusNotFound, "Can't find project")
+	}
+	if key != project.ID.Hex() && key != project.Slug {
+		return c.Redirect(http.StatusMovedPermanently, "/projects/"+project.Slug)
+	}
+	if !project.HasRole(userID, models.RoleOwner) {
+		// Pending invitations are only shown to the owner
+		project.Team = project.PublicTeam()
 	}
+	setETag(c, project.Version)
 	return c.JSON(http.StatusFound, project)
 }
 
-type projectSearch struct {
-	SearchType string `json:"search_type"`
-	Title      string `json:"title,omitempty"`
-	Category   string `json:"category,omitempty"`
-	Tags       string `json:"tags,omitempty"`
-	Order      string `json:"order,omitempty"`
-}
+// GetTrending returns the projects with the most recent activity in the window query
+// parameter: day, week (the default) or month
+func (p *Projects) GetTrending(c echo.Context) error {
+	window := c.QueryParam("window")
+	if window == "" {
+		window = models.TrendingWeek
+	}
 
-// SearchProject handles looking for a project with a given title
-func (p *Projects) SearchProject(c echo.Context) error {
-	ps := new(projectSearch)
-	if err := c.Bind(&ps); err != nil {
-		return c.String(http.StatusBadRequest, "Can't bind request body")
+	page, err := getPage(c)
+	if err != nil {
+		return err
 	}
 
-	var projects []models.Project
-	var err error
+	projects, err := p.projectStore.GetTrending(c.Request().Context(), window, page)
+	if err == models.ErrInvalidWindow {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't get trending projects", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't get trending projects")
+	}
 
-	switch ps.SearchType {
-	case "title":
-		projects, err = p.projectStore.GetByTitle(ps.Title)
+	return sendProjectPage(c, http.StatusOK, projects)
+}
 
-	case "category":
-		projects, err = p.projectStore.GetByCategory(ps.Category)
+// SearchProject handles looking for projects matching a query, with facets for the matches
+func (p *Projects) SearchProject(c echo.Context) error {
+	query := new(models.ProjectQuery)
+	if err := c.Bind(query); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind request body")
+	}
 
-	case "tags":
-		tags := strings.Fields(ps.Tags)
-		projects, err = p.projectStore.GetByTags(tags)
+	if err := query.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
-	case "full":
-		projects, err = p.projectStore.GetFullSearch(ps.Title, ps.Category, ps.Order)
+	page, err := getPage(c)
+	if err != nil {
+		return err
+	}
 
-	default:
-		return c.String(http.StatusBadRequest, "Please provide a valid search type (title, tags, category)")
+	result, err := p.projectStore.Search(c.Request().Context(), *query, page)
+	if err != nil {
+		logError(c, "Can't search projects", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't search projects")
 	}
 
+	setNextPageLink(c, result.NextCursor)
+	return c.JSON(http.StatusFound, result)
+}
+
+// Suggest returns the projects with a title word starting with the q query parameter
+func (p *Projects) Suggest(c echo.Context) error {
+	projects, err := p.projectStore.Suggest(c.Request().Context(), c.QueryParam("q"), suggestionsLimit)
 	if err != nil {
-		return c.String(http.StatusNotFound, "No projects matching search")
+		logError(c, "Can't suggest projects", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't suggest projects")
 	}
 
-	return c.JSON(http.StatusFound, projects)
+	return c.JSON(http.StatusOK, projects)
 }
 
 // GetByOwner returns all the projects a user owns
 func (p *Projects) GetByOwner(c echo.Context) error {
 	id := c.Param("userId")
 	if id == "" {
-		return c.String(http.StatusBadRequest, "No user id")
+		return echo.NewHTTPError(http.StatusBadRequest, "No user id")
 	}
 
-	projects, err := p.projectStore.GetByOwnerID(id)
+	page, err := getPage(c)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	return c.JSON(http.StatusOK, projects)
+	// Owners and admins also see the drafts
+	drafts := id == getTokenStringClaimByKey(c, "id") || isAdmin(c, &p.userStore)
+	projects, err := p.projectStore.GetByOwnerID(c.Request().Context(), id, drafts, page)
+	if err != nil {
+		logError(c, "Can't get owned projects", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return sendProjectPage(c, http.StatusOK, projects)
 }
 
 // GetVotedFor returns the projects voted for by a user
 func (p *Projects) GetVotedFor(c echo.Context) error {
 	id := c.Param("userId")
 	if id == "" {
-		return c.String(http.StatusBadRequest, "No user id")
+		return echo.NewHTTPError(http.StatusBadRequest, "No user id")
 	}
 
-	projects, err := p.projectStore.GetVotedProjects(id)
+	page, err := getPage(c)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	return c.JSON(http.StatusOK, projects)
+	projects, err := p.projectStore.GetVotedProjects(c.Request().Context(), id, page)
+	if err != nil {
+		logError(c, "Can't get voted projects", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return sendProjectPage(c, http.StatusOK, projects)
 }
 
 // GetContributedTo returns the projects contributed to by a user
 func (p *Projects) GetContributedTo(c echo.Context) error {
 	id := c.Param("userId")
 	if id == "" {
-		return c.String(http.StatusBadRequest, "No user id")
+		return echo.NewHTTPError(http.StatusBadRequest, "No user id")
 	}
 
-	projects, err := p.projectStore.GetContributedProjects(id)
+	page, err := getPage(c)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	return c.JSON(http.StatusOK, projects)
+	projects, err := p.projectStore.GetContributedProjects(c.Request().Context(), id, page)
+	if err != nil {
+		logError(c, "Can't get contributed projects", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return sendProjectPage(c, http.StatusOK, projects)
 }
 
 // VoteForProject handles a user voting or unvoting a project
@@ -166,43 +244,163 @@ func (p *Projects) VoteForProject(c echo.Context) error {
 	upvoteStr := c.QueryParam("upvote")
 	upvote, err := strconv.ParseBool(upvoteStr)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "Invalid query parameter")
+		logError(c, "Invalid upvote query parameter", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameter")
 	}
 
 	userID := getTokenStringClaimByKey(c, "id")
-	if err := p.projectStore.Vote(id, userID, upvote); err != nil {
-		return c.String(http.StatusBadRequest, "Couldn't upvote project")
+	if err := p.projectStore.Vote(c.Request().Context(), id, userID, upvote); err != nil {
+		logError(c, "Can't vote for project", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Couldn't upvote project")
+	}
+	if upvote {
+		metrics.Event(metrics.Vote)
+	} else {
+		metrics.Event(metrics.Unvote)
 	}
 	return c.JSON(http.StatusOK, "")
 }
 
-// Delete deletes a project permanently
+// Delete moves a project to the trash, its owner can restore it within the restore window
 func (p *Projects) Delete(c echo.Context) error {
 	id := c.Param("id")
+
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleOwner, "delete it"); err != nil {
+		return err
+	}
+
+	deletedAt, err := p.projectStore.Delete(c.Request().Context(), id)
+	if err == models.ErrHasContributions {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't delete project", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "Project deleted",
+		"restore_until": deletedAt.Add(p.restoreWindow),
+	})
+}
+
+// Restore takes a project out of the trash, only its owner can restore it
+func (p *Projects) Restore(c echo.Context) error {
 	userID := getTokenStringClaimByKey(c, "id")
+	err := p.projectStore.Restore(c.Request().Context(), c.Param("id"), userID, p.restoreWindow)
+	if err == models.ErrNotRestorable {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		logError(c, "Can't restore project", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Project restored")
+}
 
-	project, err := p.projectStore.GetByID(id)
+// GetDeleted returns the projects in the user's trash that can still be restored
+func (p *Projects) GetDeleted(c echo.Context) error {
+	page, err := getPage(c)
 	if err != nil {
-		return c.String(http.StatusNotFound, err.Error())
+		return err
 	}
 
-	if project.Owner.Hex() != userID {
-		return c.String(http.StatusUnauthorized, "You must be the project owner to delete it")
+	userID := getTokenStringClaimByKey(c, "id")
+	projects, err := p.projectStore.GetDeleted(c.Request().Context(), userID, p.restoreWindow, page)
+	if err != nil {
+		logError(c, "Can't get deleted projects", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	if err := p.projectStore.Delete(id); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+	return sendProjectPage(c, http.StatusOK, projects)
+}
+
+type publishRequest struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// Publish launches a draft now or schedules it for the publish_at time, only its owner can publish it
+func (p *Projects) Publish(c echo.Context) error {
+	id := c.Param("id")
+
+	pr := new(publishRequest)
+	if err := c.Bind(pr); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleOwner, "publish it"); err != nil {
+		return err
+	}
+
+	at := time.Now()
+	if pr.PublishAt != nil {
+		at = *pr.PublishAt
+	}
+
+	if err := p.projectStore.Publish(c.Request().Context(), id, at); err != nil {
+		logError(c, "Can't publish project", err)
+		if _, ok := err.(models.MissingFieldsError); ok || err == models.ErrNoGoal {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+		if err == models.ErrInvalidTransition || err == models.ErrNotDraft {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, "Project deleted")
+	if at.After(time.Now()) {
+		return c.JSON(http.StatusAccepted, "Project scheduled")
+	}
+	return c.JSON(http.StatusOK, "Project published")
+}
+
+// Unschedule cancels the scheduled publication of a draft, only its owner can unschedule it
+func (p *Projects) Unschedule(c echo.Context) error {
+	id := c.Param("id")
+
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleOwner, "unschedule it"); err != nil {
+		return err
+	}
+
+	if err := p.projectStore.Unschedule(c.Request().Context(), id); err != nil {
+		logError(c, "Can't unschedule project", err)
+		if err == models.ErrNotDraft {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Project unscheduled")
+}
+
+// Cancel stops a project campaign, only its owner can cancel it
+func (p *Projects) Cancel(c echo.Context) error {
+	id := c.Param("id")
+
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleOwner, "cancel it"); err != nil {
+		return err
+	}
+
+	if err := p.projectStore.Transition(c.Request().Context(), id, models.StatusCancelled); err != nil {
+		logError(c, "Can't cancel project", err)
+		if err == models.ErrInvalidTransition {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Project cancelled")
 }
 
 // View increments a projects views
 func (p *Projects) View(c echo.Context) error {
 	id := c.Param("id")
 
-	if err := p.projectStore.View(id); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+	if err := p.projectStore.View(c.Request().Context(), id); err != nil {
+		logError(c, "Can't update project views", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
 	return c.JSON(http.StatusAccepted, "Project views updated")
@@ -219,18 +417,22 @@ func (p *Projects) Comment(c echo.Context) error {
 
 	cr := new(commentRequest)
 	if err := c.Bind(cr); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	if err := p.projectStore.AddComment(id, user, cr.Text); err != nil {
-		return c.String(http.StatusNotFound, err.Error())
+	if err := p.projectStore.AddComment(c.Request().Context(), id, user, cr.Text); err != nil {
+		logError(c, "Can't add comment", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 
+	metrics.Event(metrics.Comment)
 	return c.JSON(http.StatusAccepted, "Comment successfully created")
 }
 
 type contributionRequest struct {
-	Amount float32 `json:"amount"`
+	Amount   float32 `json:"amount"`
+	RewardID string  `json:"reward_id,omitempty"`
 }
 
 // Contribute handles adding a contribution to a project
@@ -240,12 +442,124 @@ func (p *Projects) Contribute(c echo.Context) error {
 
 	cr := new(contributionRequest)
 	if err := c.Bind(cr); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	if err := p.projectStore.AddContribution(id, user, cr.Amount); err != nil {
-		return c.String(http.StatusNotFound, err.Error())
+	if err := p.projectStore.AddContribution(c.Request().Context(), id, user, cr.Amount, cr.RewardID); err != nil {
+		logError(c, "Can't add contribution", err)
+		switch err {
+		case models.ErrInvalidAmount, models.ErrBelowMinimum:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case models.ErrCampaignNotActive, models.ErrRewardSoldOut:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 
+	metrics.Event(metrics.Contribution)
 	return c.JSON(http.StatusAccepted, "Contribution successfully added")
 }
+
+// AddReward adds a reward tier to a project
+func (p *Projects) AddReward(c echo.Context) error {
+	er := new(models.EditReward)
+	if err := c.Bind(er); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := er.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleEditor, "add rewards"); err != nil {
+		return err
+	}
+
+	reward, err := p.projectStore.AddReward(c.Request().Context(), c.Param("id"), *er)
+	if err != nil {
+		logError(c, "Can't add reward", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, reward)
+}
+
+// UpdateReward edits a reward tier of a project
+func (p *Projects) UpdateReward(c echo.Context) error {
+	er := new(models.EditReward)
+	if err := c.Bind(er); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := er.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleEditor, "edit rewards"); err != nil {
+		return err
+	}
+
+	if err := p.projectStore.UpdateReward(c.Request().Context(), c.Param("id"), c.Param("rewardId"), *er); err != nil {
+		logError(c, "Can't update reward", err)
+		switch err {
+		case models.ErrRewardNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case models.ErrRewardChanged:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Reward updated")
+}
+
+// RemoveReward removes a reward tier that has no backers from a project
+func (p *Projects) RemoveReward(c echo.Context) error {
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleEditor, "remove rewards"); err != nil {
+		return err
+	}
+
+	if err := p.projectStore.RemoveReward(c.Request().Context(), c.Param("id"), c.Param("rewardId")); err != nil {
+		logError(c, "Can't remove reward", err)
+		switch err {
+		case models.ErrRewardNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case models.ErrRewardHasBackers:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Reward removed")
+}
+
+// GetRewardBackers returns the contributions that chose a reward tier, only the project team can see them
+func (p *Projects) GetRewardBackers(c echo.Context) error {
+	if _, err := getProjectWithRole(c, &p.projectStore, models.RoleViewer, "see the backers"); err != nil {
+		return err
+	}
+
+	backers, err := p.projectStore.GetRewardBackers(c.Request().Context(), c.Param("id"), c.Param("rewardId"))
+	if err != nil {
+		logError(c, "Can't get reward backers", err)
+		if err == models.ErrRewardNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, backers)
+}
+
+// GetAnalytics returns the activity summary of a project, only the project team can see it
+func (p *Projects) GetAnalytics(c echo.Context) error {
+	project, err := getProjectWithRole(c, &p.projectStore, models.RoleViewer, "see its analytics")
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, project.Analytics())
+}
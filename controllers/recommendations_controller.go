@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Recommendations represents a project recommendations controller
+type Recommendations struct {
+	recommendationStore models.RecommendationStore
+	userStore           models.UserStore
+}
+
+// NewRecommendationsController creates a new recommendations controller with its stores
+func NewRecommendationsController(rs models.RecommendationStore, us models.UserStore) Recommendations {
+	return Recommendations{recommendationStore: rs, userStore: us}
+}
+
+// GetByUser returns a page of the projects recommended to a user, only the user and admins can see them
+func (r *Recommendations) GetByUser(c echo.Context) error {
+	id := c.Param("id")
+	if id != getTokenStringClaimByKey(c, "id") && !isAdmin(c, &r.userStore) {
+		return echo.NewHTTPError(http.StatusForbidden, "You can only see your own recommendations")
+	}
+
+	page, err := getPage(c)
+	if err != nil {
+		return err
+	}
+
+	projects, err := r.recommendationStore.GetProjects(c.Request().Context(), id, page)
+	if err != nil {
+		logError(c, "Can't get recommendations", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return sendProjectPage(c, http.StatusOK, projects)
+}
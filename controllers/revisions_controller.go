@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Revisions represents a project revisions controller
+type Revisions struct {
+	revisionStore models.RevisionStore
+	projectStore  models.ProjectStore
+	userStore     models.UserStore
+}
+
+// NewRevisionsController creates a new revisions controller with its stores
+func NewRevisionsController(rs models.RevisionStore, ps models.ProjectStore, us models.UserStore) Revisions {
+	return Revisions{revisionStore: rs, projectStore: ps, userStore: us}
+}
+
+// GetByProject returns a page of the revisions of a project, newest first
+func (r *Revisions) GetByProject(c echo.Context) error {
+	if _, err := r.getOwnedProject(c); err != nil {
+		return err
+	}
+
+	page, err := getPage(c)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := r.revisionStore.GetByProject(c.Request().Context(), c.Param("id"), page)
+	if err != nil {
+		logError(c, "Can't get project revisions", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	setNextPageLink(c, revisions.NextCursor)
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// Restore brings a project back to how it was right after a revision
+func (r *Revisions) Restore(c echo.Context) error {
+	if _, err := r.getOwnedProject(c); err != nil {
+		return err
+	}
+
+	userID := getTokenStringClaimByKey(c, "id")
+	project, err := r.projectStore.RestoreRevision(c.Request().Context(), c.Param("id"), c.Param("revisionId"), userID)
+	switch {
+	case err == models.ErrRevisionNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case err != nil:
+		logError(c, "Can't restore project revision", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	setETag(c, project.Version)
+	return c.JSON(http.StatusOK, project)
+}
+
+// getOwnedProject finds the project in the id param if the user owns it or is an admin
+func (r *Revisions) getOwnedProject(c echo.Context) (models.Project, error) {
+	if !isAdmin(c, &r.userStore) {
+		return getProjectWithRole(c, &r.projectStore, models.RoleOwner, "see its revisions")
+	}
+
+	project, err := r.projectStore.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		logError(c, "Can't find project", err)
+		return models.Project{}, echo.NewHTTPError(http.StatusNotFound, "Can't find project")
+	}
+	return project, nil
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+// suggestionsLimit is the number of suggestions returned while typing
+const suggestionsLimit = 10
+
+// Tags represents a tags controller
+type Tags struct {
+	tagStore models.TagStore
+}
+
+// NewTagsController creates a new tags controller with a store
+func NewTagsController(ts models.TagStore) Tags {
+	return Tags{tagStore: ts}
+}
+
+// Suggest returns the most used tags starting with the q query parameter
+func (t *Tags) Suggest(c echo.Context) error {
+	tags, err := t.tagStore.Suggest(c.Request().Context(), c.QueryParam("q"), suggestionsLimit)
+	if err != nil {
+		logError(c, "Can't suggest tags", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't suggest tags")
+	}
+
+	return c.JSON(http.StatusOK, tags)
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Team represents a project team controller
+type Team struct {
+	projectStore      models.ProjectStore
+	notificationStore models.NotificationStore
+	userStore         models.UserStore
+}
+
+// NewTeamController creates a new team controller with its stores
+func NewTeamController(ps models.ProjectStore, ns models.NotificationStore, us models.UserStore) Team {
+	return Team{projectStore: ps, notificationStore: ns, userStore: us}
+}
+
+type inviteRequest struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// Invite invites a user to the project team, only the owner can invite
+func (t *Team) Invite(c echo.Context) error {
+	ir := new(inviteRequest)
+	if err := c.Bind(ir); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	uid, err := primitive.ObjectIDFromHex(ir.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user id")
+	}
+
+	project, err := getProjectWithRole(c, &t.projectStore, models.RoleOwner, "invite members")
+	if err != nil {
+		return err
+	}
+
+	if err := t.projectStore.InviteMember(c.Request().Context(), c.Param("id"), ir.UserID, ir.Role); err != nil {
+		logError(c, "Can't invite member", err)
+		switch err {
+		case models.ErrInvalidRole:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case models.ErrAlreadyMember:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	notification := models.Notification{
+		Project: project.ID,
+		Kind:    models.NotifyTeamInvite,
+		Message: fmt.Sprintf("You were invited to %q as %s", project.Title, ir.Role),
+	}
+	if err := t.notificationStore.Notify(c.Request().Context(), []primitive.ObjectID{uid}, notification); err != nil {
+		logError(c, "Can't notify team invite", err)
+	}
+
+	return c.JSON(http.StatusCreated, "Member invited")
+}
+
+// Accept adds the authenticated user to the team of a project that invited them
+func (t *Team) Accept(c echo.Context) error {
+	userID := getTokenStringClaimByKey(c, "id")
+
+	if err := t.projectStore.AcceptInvite(c.Request().Context(), c.Param("id"), userID); err != nil {
+		logError(c, "Can't accept invite", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Invite accepted")
+}
+
+// Remove removes a member from the project team. The owner can remove anyone,
+// and members can remove themselves to leave or decline an invitation
+func (t *Team) Remove(c echo.Context) error {
+	memberID := c.Param("userId")
+	if memberID != getTokenStringClaimByKey(c, "id") {
+		if _, err := getProjectWithRole(c, &t.projectStore, models.RoleOwner, "remove members"); err != nil {
+			return err
+		}
+	}
+
+	if err := t.projectStore.RemoveMember(c.Request().Context(), c.Param("id"), memberID); err != nil {
+		logError(c, "Can't remove member", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Member removed")
+}
+
+type transferRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// ProposeTransfer offers the ownership of a project to another user, only the owner can propose it
+func (t *Team) ProposeTransfer(c echo.Context) error {
+	tr := new(transferRequest)
+	if err := c.Bind(tr); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	uid, err := primitive.ObjectIDFromHex(tr.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user id")
+	}
+
+	project, err := getProjectWithRole(c, &t.projectStore, models.RoleOwner, "transfer it")
+	if err != nil {
+		return err
+	}
+
+	userID := getTokenStringClaimByKey(c, "id")
+	if err := t.projectStore.ProposeTransfer(c.Request().Context(), c.Param("id"), userID, tr.UserID); err != nil {
+		logError(c, "Can't propose ownership transfer", err)
+		if err == models.ErrSelfTransfer {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	notification := models.Notification{
+		Project: project.ID,
+		Kind:    models.NotifyTransferProposed,
+		Message: fmt.Sprintf("You were offered the ownership of %q", project.Title),
+	}
+	if err := t.notificationStore.Notify(c.Request().Context(), []primitive.ObjectID{uid}, notification); err != nil {
+		logError(c, "Can't notify ownership transfer", err)
+	}
+
+	return c.JSON(http.StatusCreated, "Ownership transfer proposed")
+}
+
+// AcceptTransfer makes the authenticated user the owner of a project offered to them
+func (t *Team) AcceptTransfer(c echo.Context) error {
+	userID := getTokenStringClaimByKey(c, "id")
+
+	previousOwner, err := t.projectStore.AcceptTransfer(c.Request().Context(), c.Param("id"), userID)
+	if err != nil {
+		logError(c, "Can't accept ownership transfer", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	pid, _ := primitive.ObjectIDFromHex(c.Param("id"))
+	notification := models.Notification{
+		Project: pid,
+		Kind:    models.NotifyTransferAccepted,
+		Message: "Your project ownership transfer was accepted",
+	}
+	if err := t.notificationStore.Notify(c.Request().Context(), []primitive.ObjectID{previousOwner}, notification); err != nil {
+		logError(c, "Can't notify ownership transfer", err)
+	}
+
+	return c.JSON(http.StatusOK, "Ownership transferred")
+}
+
+// CancelTransfer withdraws a pending transfer, the owner can cancel it and the recipient can decline it
+func (t *Team) CancelTransfer(c echo.Context) error {
+	userID := getTokenStringClaimByKey(c, "id")
+
+	if err := t.projectStore.CancelTransfer(c.Request().Context(), c.Param("id"), userID); err != nil {
+		logError(c, "Can't cancel ownership transfer", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Ownership transfer cancelled")
+}
+
+// GetOwnership returns the pending transfer and the ownership history of a project,
+// only the project team and admins can see them
+func (t *Team) GetOwnership(c echo.Context) error {
+	project, err := t.projectStore.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		logError(c, "Can't find project", err)
+		return echo.NewHTTPError(http.StatusNotFound, "Can't find project")
+	}
+
+	if !project.HasRole(getTokenStringClaimByKey(c, "id"), models.RoleViewer) && !isAdmin(c, &t.userStore) {
+		return echo.NewHTTPError(http.StatusForbidden, "You must be a project viewer to see its ownership")
+	}
+
+	history := project.OwnershipHistory
+	if history == nil {
+		history = make([]models.OwnershipEvent, 0)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"owner":    project.Owner,
+		"transfer": project.Transfer,
+		"history":  history,
+	})
+}
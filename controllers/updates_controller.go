@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Updates represents a project updates controller
+type Updates struct {
+	updateStore       models.UpdateStore
+	projectStore      models.ProjectStore
+	notificationStore models.NotificationStore
+	userStore         models.UserStore
+}
+
+// NewUpdatesController creates a new updates controller with its stores
+func NewUpdatesController(us models.UpdateStore, ps models.ProjectStore, ns models.NotificationStore, users models.UserStore) Updates {
+	return Updates{updateStore: us, projectStore: ps, notificationStore: ns, userStore: users}
+}
+
+// Create posts an update on a project and notifies its voters and contributors
+func (u *Updates) Create(c echo.Context) error {
+	eu := new(models.EditUpdate)
+	if err := c.Bind(eu); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := eu.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	project, err := getProjectWithRole(c, &u.projectStore, models.RoleEditor, "post updates")
+	if err != nil {
+		return err
+	}
+
+	userID := getTokenStringClaimByKey(c, "id")
+	update, err := u.updateStore.Create(c.Request().Context(), c.Param("id"), userID, *eu)
+	if err != nil {
+		logError(c, "Can't create update", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	u.notify(c, project, update)
+	return c.JSON(http.StatusCreated, update)
+}
+
+// Edit replaces the content of an update
+func (u *Updates) Edit(c echo.Context) error {
+	eu := new(models.EditUpdate)
+	if err := c.Bind(eu); err != nil {
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := eu.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := getProjectWithRole(c, &u.projectStore, models.RoleEditor, "edit updates"); err != nil {
+		return err
+	}
+
+	if err := u.updateStore.Edit(c.Request().Context(), c.Param("id"), c.Param("updateId"), *eu); err != nil {
+		logError(c, "Can't edit update", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Update edited")
+}
+
+// Delete removes an update
+func (u *Updates) Delete(c echo.Context) error {
+	if _, err := getProjectWithRole(c, &u.projectStore, models.RoleEditor, "delete updates"); err != nil {
+		return err
+	}
+
+	if err := u.updateStore.Delete(c.Request().Context(), c.Param("id"), c.Param("updateId")); err != nil {
+		logError(c, "Can't delete update", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, "Update deleted")
+}
+
+// GetFeed returns a page of the updates of a project, backers only updates are
+// included for the contributors, the project team and admins
+func (u *Updates) GetFeed(c echo.Context) error {
+	project, err := u.getVisibleProject(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := getPage(c)
+	if err != nil {
+		return err
+	}
+
+	backers, err := u.isBacker(c, project)
+	if err != nil {
+		logError(c, "Can't check project backers", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	updates, err := u.updateStore.GetByProject(c.Request().Context(), c.Param("id"), backers, page)
+	if err != nil {
+		logError(c, "Can't get project updates", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	setNextPageLink(c, updates.NextCursor)
+	return c.JSON(http.StatusOK, updates)
+}
+
+// GetByID returns an update of a project
+func (u *Updates) GetByID(c echo.Context) error {
+	project, err := u.getVisibleProject(c)
+	if err != nil {
+		return err
+	}
+
+	update, err := u.updateStore.GetByID(c.Request().Context(), c.Param("id"), c.Param("updateId"))
+	if err != nil {
+		logError(c, "Can't find update", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	if update.Visibility == models.VisibilityBackers {
+		backers, err := u.isBacker(c, project)
+		if err != nil {
+			logError(c, "Can't check project backers", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if !backers {
+			return echo.NewHTTPError(http.StatusForbidden, "This update is only for the project backers")
+		}
+	}
+
+	return c.JSON(http.StatusOK, update)
+}
+
+// getVisibleProject finds the project in the id param if the user can see it
+func (u *Updates) getVisibleProject(c echo.Context) (models.Project, error) {
+	project, err := u.projectStore.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil || !project.CanSee(getTokenStringClaimByKey(c, "id"), false) && !isAdmin(c, &u.userStore) {
+		logError(c, "Can't find project", err)
+		return models.Project{}, echo.NewHTTPError(http.StatusNotFound, "Can't find project")
+	}
+	return project, nil
+}
+
+// isBacker checks if the user can read the backers only updates of a project
+func (u *Updates) isBacker(c echo.Context, project models.Project) (bool, error) {
+	userID := getTokenStringClaimByKey(c, "id")
+	if userID == "" {
+		return false, nil
+	}
+	if project.RoleOf(userID) != "" || isAdmin(c, &u.userStore) {
+		return true, nil
+	}
+	return u.projectStore.IsBacker(c.Request().Context(), project.ID.Hex(), userID)
+}
+
+// notify tells the voters and contributors of a project about a new update, or only the
+// contributors for backers only updates. Failures are logged since the update was already posted
+func (u *Updates) notify(c echo.Context, project models.Project, update models.ProjectUpdate) {
+	voters, backers, err := u.projectStore.Audience(c.Request().Context(), project.ID.Hex())
+	if err != nil {
+		logError(c, "Can't get project audience", err)
+		return
+	}
+
+	recipients := backers
+	if update.Visibility == models.VisibilityPublic {
+		recipients = append(recipients, voters...)
+	}
+	recipients = withoutUser(recipients, update.Author)
+
+	notification := models.Notification{
+		Project: project.ID,
+		Kind:    models.NotifyProjectUpdate,
+		Message: fmt.Sprintf("%q posted an update: %s", project.Title, update.Title),
+	}
+	if err := u.notificationStore.Notify(c.Request().Context(), recipients, notification); err != nil {
+		logError(c, "Can't notify project update", err)
+	}
+}
+
+func withoutUser(users []primitive.ObjectID, user primitive.ObjectID) []primitive.ObjectID {
+	filtered := make([]primitive.ObjectID, 0, len(users))
+	for _, id := range users {
+		if id != user {
+			filtered = append(filtered, id)
+		}
+	}
+	return filtered
+}
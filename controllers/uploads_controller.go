@@ -22,17 +22,20 @@ func (u *Uploads) Upload(c echo.Context) error {
 	name := c.FormValue("name")
 	file, err := c.FormFile("image")
 	if err != nil {
+		logError(c, "Can't read uploaded file", err)
 		return err
 	}
 	src, err := file.Open()
 	if err != nil {
+		logError(c, "Can't open uploaded file", err)
 		return err
 	}
 	defer src.Close()
 
-	err = u.uploadsStore.Upload(name, src)
+	err = u.uploadsStore.Upload(c.Request().Context(), name, src)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Couldn't upload file")
+		logError(c, "Couldn't upload file", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't upload file")
 	}
 
 	url := u.uploadsStore.URL + "/" + name
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/jpr98/apis_pf_back/metrics"
 	"github.com/jpr98/apis_pf_back/models"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -13,22 +14,22 @@ import (
 // Users represents a users controller
 type Users struct {
 	userStore models.UserStore
+	secret    []byte
 }
 
-// NewUsersController creates a new users controller
-func NewUsersController(us models.UserStore) Users {
-	return Users{userStore: us}
+// NewUsersController creates a new users controller that signs tokens with secret
+func NewUsersController(us models.UserStore, secret []byte) Users {
+	return Users{userStore: us, secret: secret}
 }
 
 // ValidateToken checks if a token is valid
 func (u *Users) ValidateToken(c echo.Context) error {
 	tokenString := c.Param("token")
 
-	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte("secret"), nil
-	})
+	_, err := jwt.Parse(tokenString, hmacKey(u.secret))
 	if err != nil {
-		return c.String(http.StatusUnauthorized, "Invalid token")
+		logError(c, "Invalid token", err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
@@ -39,12 +40,13 @@ func (u *Users) ValidateToken(c echo.Context) error {
 // GetByID returns a user by a given id
 func (u *Users) GetByID(c echo.Context) error {
 	id := c.Param("id")
-	user, err := u.userStore.GetByID(id)
+	user, err := u.userStore.GetByID(c.Request().Context(), id)
 	if err != nil {
-		c.Logger().Errorf("Can't find user", err)
-		return c.String(http.StatusNotFound, "Can't find user")
+		logError(c, "Can't find user", err)
+		return echo.NewHTTPError(http.StatusNotFound, "Can't find user")
 	}
 	user.Password = ""
+	setETag(c, user.Version)
 	return c.JSON(http.StatusOK, user)
 }
 
@@ -52,40 +54,48 @@ func (u *Users) GetByID(c echo.Context) error {
 func (u *Users) Create(c echo.Context) error {
 	user := new(models.User)
 	if err := c.Bind(user); err != nil {
-		c.Logger().Error("Can't bind body to JSON")
-		return c.String(http.StatusBadRequest, "Can't bind body to json")
+		logError(c, "Can't bind body to JSON", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind body to json")
 	}
-	if !u.userStore.ValidEmail(user.Email) {
-		return c.String(http.StatusConflict, "Email taken")
+	if !u.userStore.ValidEmail(c.Request().Context(), user.Email) {
+		return echo.NewHTTPError(http.StatusConflict, "Email taken")
 	}
-	createdUser, err := u.userStore.Create(*user)
+	createdUser, err := u.userStore.Create(c.Request().Context(), *user)
 	if err != nil {
-		c.Logger().Errorf("Can't create user", err)
-		return c.String(http.StatusInternalServerError, "Can't create user")
+		logError(c, "Can't create user", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Can't create user")
 	}
 
+	metrics.Event(metrics.Signup)
 	createdUser.Password = ""
 	return c.JSON(http.StatusCreated, createdUser)
 }
 
-// Update updates a user's info
+// Update applies a partial update to a user's info, only the fields in the body are
+// changed and fields set to null are cleared
 func (u *Users) Update(c echo.Context) error {
-	eu := new(models.EditUser)
-	if err := c.Bind(eu); err != nil {
-		return c.String(http.StatusBadRequest, "Can't bind body to json")
-	}
-
 	id := c.Param("id")
 	if id != getTokenStringClaimByKey(c, "id") {
-		return c.String(http.StatusForbidden, "You can only update your own info")
+		return echo.NewHTTPError(http.StatusForbidden, "You can only update your own info")
 	}
 
-	err := u.userStore.Update(id, *eu)
+	patch, conditional, err := readPatch(c, models.ParseUserPatch)
 	if err != nil {
-		return c.String(http.StatusNotFound, err.Error())
+		return err
 	}
 
-	return c.JSON(http.StatusAccepted, "Updated")
+	user, err := u.userStore.Patch(c.Request().Context(), id, patch)
+	if err == models.ErrVersionConflict {
+		return patchConflict(c, conditional)
+	}
+	if err != nil {
+		logError(c, "Can't update user", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	user.Password = ""
+	setETag(c, user.Version)
+	return c.JSON(http.StatusOK, user)
 }
 
 // AuthBody is the content for auth requests
@@ -98,16 +108,19 @@ type AuthBody struct {
 func (u *Users) Login(c echo.Context) error {
 	var auth AuthBody
 	if err := c.Bind(&auth); err != nil {
-		return c.String(http.StatusBadRequest, "Can't bind request body")
+		logError(c, "Can't bind request body", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Can't bind request body")
 	}
 
-	user, err := u.userStore.GetByEmail(auth.Email)
+	user, err := u.userStore.GetByEmail(c.Request().Context(), auth.Email)
 	if err != nil {
+		logError(c, "Can't find user to log in", err)
 		return echo.ErrUnauthorized
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(auth.Password))
 	if err != nil {
+		logError(c, "Invalid password", err)
 		return echo.ErrUnauthorized
 	}
 
@@ -116,13 +129,16 @@ func (u *Users) Login(c echo.Context) error {
 	claims := token.Claims.(jwt.MapClaims)
 	claims["id"] = user.ID
 	claims["name"] = user.Name
+	claims["role"] = user.Role
 	claims["exp"] = time.Now().Add(72 * time.Hour).Unix()
 
-	t, err := token.SignedString([]byte("secret"))
+	t, err := token.SignedString(u.secret)
 	if err != nil {
+		logError(c, "Can't sign token", err)
 		return echo.ErrInternalServerError
 	}
 
+	metrics.Event(metrics.Login)
 	return c.JSON(http.StatusOK, map[string]string{
 		"token": t,
 		"id":    user.ID.Hex(),
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/jpr98/apis_pf_back/tracing"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -20,7 +21,7 @@ type MongoDatastore struct {
 func NewDatastore(uri string, log echo.Logger) (*MongoDatastore, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri).SetMonitor(tracing.MongoMonitor()))
 	if err != nil {
 		return nil, err
 	}
@@ -6,7 +6,12 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/jpr98/apis_pf_back/metrics"
+	"github.com/jpr98/apis_pf_back/tracing"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // StorageDatastore contains the information of Google Cloud Storage
@@ -36,12 +41,24 @@ func NewStorageDatastore(bucket string, log echo.Logger) (*StorageDatastore, err
 }
 
 // Upload uploads a file with a given name to GCP Storage
-func (sd *StorageDatastore) Upload(name string, file io.Reader) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
-	defer cancel()
+func (sd *StorageDatastore) Upload(ctx context.Context, name string, file io.Reader) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "storage.Upload", trace.WithAttributes(
+		label.String("storage.bucket_url", sd.URL),
+		label.String("storage.object", name),
+	))
+	var written int64
+	defer func() {
+		metrics.ObserveUpload(written, err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.SetAttributes(label.Int64("storage.bytes", written))
+		span.End()
+	}()
 
 	wc := sd.Bucket.Object(name).NewWriter(ctx)
-	if _, err := io.Copy(wc, file); err != nil {
+	if written, err = io.Copy(wc, file); err != nil {
 		return err
 	}
 	if err := wc.Close(); err != nil {
@@ -6,6 +6,13 @@ require (
 	cloud.google.com/go/storage v1.12.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/labstack/echo/v4 v4.1.17
+	github.com/labstack/gommon v0.3.0
+	github.com/microcosm-cc/bluemonday v1.0.4
+	github.com/prometheus/client_golang v1.8.0
 	go.mongodb.org/mongo-driver v1.4.3
+	go.opentelemetry.io/otel v0.14.0
+	go.opentelemetry.io/otel/exporters/otlp v0.14.0
+	go.opentelemetry.io/otel/exporters/stdout v0.14.0
+	go.opentelemetry.io/otel/sdk v0.14.0
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
 )
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CloseCampaigns marks the campaigns that reached their end date as funded or failed
+// and notifies their owners and contributors
+func CloseCampaigns(projectStore *models.ProjectStore, notificationStore *models.NotificationStore, interval time.Duration) Job {
+	return Job{
+		Name:     "close-campaigns",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			closed, err := projectStore.CloseEndedCampaigns(ctx, time.Now())
+			for _, campaign := range closed {
+				if notifyErr := notificationStore.Notify(ctx, campaignRecipients(campaign), closingNotification(campaign)); notifyErr != nil && err == nil {
+					err = notifyErr
+				}
+			}
+			return fmt.Sprintf("%d campaigns closed", len(closed)), err
+		},
+	}
+}
+
+func campaignRecipients(campaign models.ClosedCampaign) []primitive.ObjectID {
+	return append([]primitive.ObjectID{campaign.Owner}, campaign.Contributors...)
+}
+
+func closingNotification(campaign models.ClosedCampaign) models.Notification {
+	notification := models.Notification{
+		Project: campaign.ID,
+		Kind:    models.NotifyCampaignFailed,
+		Message: fmt.Sprintf("%q didn't reach its funding goal", campaign.Title),
+	}
+	if campaign.Status == models.StatusFunded {
+		notification.Kind = models.NotifyCampaignFunded
+		notification.Message = fmt.Sprintf("%q reached its funding goal", campaign.Title)
+	}
+	return notification
+}
+
+// PublishScheduled publishes the drafts whose scheduled time arrived and notifies their owners
+func PublishScheduled(projectStore *models.ProjectStore, notificationStore *models.NotificationStore, interval time.Duration) Job {
+	return Job{
+		Name:     "publish-scheduled",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			publications, err := projectStore.PublishScheduled(ctx, time.Now())
+			published := 0
+			for _, publication := range publications {
+				notification := models.Notification{
+					Project: publication.ID,
+					Kind:    models.NotifyProjectPublished,
+					Message: fmt.Sprintf("%q was published", publication.Title),
+				}
+				if publication.Err != nil {
+					notification.Kind = models.NotifyPublishFailed
+					notification.Message = fmt.Sprintf("%q couldn't be published: %s", publication.Title, publication.Err)
+				} else {
+					published++
+				}
+				if notifyErr := notificationStore.Notify(ctx, []primitive.ObjectID{publication.Owner}, notification); notifyErr != nil && err == nil {
+					err = notifyErr
+				}
+			}
+			return fmt.Sprintf("%d drafts published, %d failed", published, len(publications)-published), err
+		},
+	}
+}
+
+// RepairVotes recomputes the votes count of the projects that are out of sync
+func RepairVotes(projectStore *models.ProjectStore, interval time.Duration) Job {
+	return Job{
+		Name:     "repair-votes",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			discrepancies, err := projectStore.RepairVotesCount(ctx)
+			return fmt.Sprintf("%d projects repaired", len(discrepancies)), err
+		},
+	}
+}
+
+// RebuildTags recomputes the tag usage counts used by the tag suggestions
+func RebuildTags(projectStore *models.ProjectStore, interval time.Duration) Job {
+	return Job{
+		Name:     "rebuild-tags",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			return "Tag usage rebuilt", projectStore.RebuildTagUsage(ctx)
+		},
+	}
+}
+
+// PurgeDeleted permanently removes the projects that were deleted longer than window ago
+func PurgeDeleted(projectStore *models.ProjectStore, window, interval time.Duration) Job {
+	return Job{
+		Name:     "purge-deleted",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			purged, err := projectStore.PurgeDeleted(ctx, time.Now().Add(-window))
+			return fmt.Sprintf("%d projects purged", purged), err
+		},
+	}
+}
+
+// RefreshTrending recomputes the trending scores from the recent project activity
+func RefreshTrending(projectStore *models.ProjectStore, interval time.Duration) Job {
+	return Job{
+		Name:     "refresh-trending",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			return "Trending scores refreshed", projectStore.RefreshTrending(ctx, time.Now())
+		},
+	}
+}
+
+// RefreshRecommendations recomputes the cached project recommendations of the users
+func RefreshRecommendations(recommendationStore *models.RecommendationStore, interval time.Duration) Job {
+	return Job{
+		Name:     "refresh-recommendations",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			users, err := recommendationStore.Refresh(ctx, time.Now())
+			return fmt.Sprintf("Recommendations of %d users refreshed", users), err
+		},
+	}
+}
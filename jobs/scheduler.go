@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/jpr98/apis_pf_back/tracing"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Job is a task the scheduler runs every Interval. Run returns a short summary of what it did
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (string, error)
+}
+
+// runStore is the part of models.JobStore used by the scheduler
+type runStore interface {
+	AcquireLease(ctx context.Context, job, instance string, ttl time.Duration) (bool, error)
+	RecordRun(ctx context.Context, run models.JobRun) error
+}
+
+// Scheduler runs jobs periodically. Every replica runs a scheduler, and the job leases
+// make sure each job runs in a single replica per interval
+type Scheduler struct {
+	store    runStore
+	instance string
+	logger   echo.Logger
+	jobs     []Job
+}
+
+// NewScheduler creates a scheduler that keeps its leases and run history in store
+func NewScheduler(store *models.JobStore, logger echo.Logger) *Scheduler {
+	host, _ := os.Hostname()
+	instance := fmt.Sprintf("%s-%s", host, primitive.NewObjectID().Hex())
+	return &Scheduler{store: store, instance: instance, logger: logger}
+}
+
+// Register adds a job, it must be called before Start
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs every job now and then on its interval until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.run(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes a job if this instance gets its lease and records the result
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	ttl, timeout := leaseTimes(job.Interval)
+	acquired, err := s.store.AcquireLease(ctx, job.Name, s.instance, ttl)
+	if err != nil {
+		s.logger.Errorj(log.JSON{"message": "Can't acquire job lease", "job": job.Name, "error": err.Error()})
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	runCtx, span := tracing.Tracer().Start(runCtx, "job "+job.Name)
+	defer span.End()
+
+	run := models.JobRun{Job: job.Name, Instance: s.instance, StartedAt: time.Now()}
+	result, err := execute(runCtx, job)
+	run.FinishedAt = time.Now()
+	run.Result = result
+	run.Status = models.JobSucceeded
+	if err != nil {
+		run.Status = models.JobFailed
+		run.Error = err.Error()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.Errorj(log.JSON{"message": "Job failed", "job": job.Name, "error": err.Error()})
+	}
+	metrics.ObserveJob(job.Name, run.FinishedAt.Sub(run.StartedAt), err)
+
+	// The history is recorded even if the job used up its context
+	recordCtx, cancelRecord := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelRecord()
+	if err := s.store.RecordRun(recordCtx, run); err != nil {
+		s.logger.Errorj(log.JSON{"message": "Can't record job run", "job": job.Name, "error": err.Error()})
+	}
+}
+
+// leaseTimes returns how long a job lease lasts and how long a run can take. The lease is
+// slightly shorter than the interval so ticks of other replicas that arrive a bit early don't
+// skip a whole interval, and runs are cancelled before the lease expires so another replica
+// can't run the job at the same time
+func leaseTimes(interval time.Duration) (ttl, timeout time.Duration) {
+	ttl = interval * 9 / 10
+	return ttl, ttl * 8 / 10
+}
+
+// execute runs a job turning a panic into an error, so a failing job doesn't stop the server
+func execute(ctx context.Context, job Job) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
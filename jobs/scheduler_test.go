@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/models"
+	"github.com/labstack/echo/v4"
+)
+
+type fakeStore struct {
+	lease bool
+	ttl   time.Duration
+	runs  []models.JobRun
+}
+
+func (fs *fakeStore) AcquireLease(ctx context.Context, job, instance string, ttl time.Duration) (bool, error) {
+	fs.ttl = ttl
+	return fs.lease, nil
+}
+
+func (fs *fakeStore) RecordRun(ctx context.Context, run models.JobRun) error {
+	fs.runs = append(fs.runs, run)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	store := &fakeStore{lease: true}
+	scheduler := Scheduler{store: store, instance: "test", logger: echo.New().Logger}
+
+	scheduler.run(context.Background(), Job{Name: "ok", Interval: time.Minute, Run: func(ctx context.Context) (string, error) {
+		return "done", nil
+	}})
+	scheduler.run(context.Background(), Job{Name: "panics", Interval: time.Minute, Run: func(ctx context.Context) (string, error) {
+		panic("boom")
+	}})
+
+	if len(store.runs) != 2 {
+		t.Fatalf("Both runs should be recorded, got %d", len(store.runs))
+	}
+
+	if store.runs[0].Status != models.JobSucceeded || store.runs[0].Result != "done" {
+		t.Error("Successful run should be recorded with its result")
+	}
+
+	if store.runs[1].Status != models.JobFailed || store.runs[1].Error == "" {
+		t.Error("Panicking run should be recorded as failed")
+	}
+}
+
+func TestRunWithoutLease(t *testing.T) {
+	store := &fakeStore{lease: false}
+	scheduler := Scheduler{store: store, instance: "test", logger: echo.New().Logger}
+
+	scheduler.run(context.Background(), Job{Name: "skipped", Interval: time.Minute, Run: func(ctx context.Context) (string, error) {
+		return "", errors.New("should not run")
+	}})
+
+	if len(store.runs) != 0 {
+		t.Error("Jobs leased by another instance should not run")
+	}
+}
+
+func TestRunOverrunningLease(t *testing.T) {
+	store := &fakeStore{lease: true}
+	scheduler := Scheduler{store: store, instance: "test", logger: echo.New().Logger}
+
+	start := time.Now()
+	scheduler.run(context.Background(), Job{Name: "slow", Interval: 100 * time.Millisecond, Run: func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}})
+
+	if elapsed := time.Since(start); elapsed >= store.ttl {
+		t.Errorf("Run took %s, it should be cancelled before its %s lease expires", elapsed, store.ttl)
+	}
+
+	if len(store.runs) != 1 || store.runs[0].Status != models.JobFailed {
+		t.Error("Cancelled run should be recorded as failed")
+	}
+}
@@ -1,7 +1,15 @@
 package main
 
-import "github.com/jpr98/apis_pf_back/app"
+import (
+	"os"
+
+	"github.com/jpr98/apis_pf_back/app"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		app.RunCommand(os.Args[1])
+		return
+	}
 	app.StartServer()
 }
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "apis_pf"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	storeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_operation_duration_seconds",
+		Help:      "Latency of mongo store operations by store and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"store", "method"})
+
+	uploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Number of file uploads by result.",
+	}, []string{"result"})
+
+	uploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes uploaded to storage.",
+	})
+
+	jobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Number of scheduled job runs by job and result.",
+	}, []string{"job", "result"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of scheduled job runs by job.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"job"})
+
+	events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Number of business events by type.",
+	}, []string{"event"})
+)
+
+// Business events counted by Event
+const (
+	Signup        = "signup"
+	Login         = "login"
+	ProjectCreate = "project_create"
+	Vote          = "vote"
+	Unvote        = "unvote"
+	Comment       = "comment"
+	Contribution  = "contribution"
+)
+
+// Handler returns the http handler that exposes the registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a finished HTTP request
+func ObserveRequest(method, route, status string, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, status).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveStore records the latency of a store method that started at start,
+// meant to be deferred at the top of the method
+func ObserveStore(store, method string, start time.Time) {
+	storeDuration.WithLabelValues(store, method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveUpload records an upload attempt and the bytes written
+func ObserveUpload(bytes int64, err error) {
+	if err != nil {
+		uploads.WithLabelValues("error").Inc()
+	} else {
+		uploads.WithLabelValues("success").Inc()
+	}
+	uploadBytes.Add(float64(bytes))
+}
+
+// ObserveJob records a scheduled job run and its duration
+func ObserveJob(job string, duration time.Duration, err error) {
+	if err != nil {
+		jobRuns.WithLabelValues(job, "error").Inc()
+	} else {
+		jobRuns.WithLabelValues(job, "success").Inc()
+	}
+	jobDuration.WithLabelValues(job).Observe(duration.Seconds())
+}
+
+// Event increments the counter of a business event
+func Event(name string) {
+	events.WithLabelValues(name).Inc()
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEvent(t *testing.T) {
+	before := testutil.ToFloat64(events.WithLabelValues(Signup))
+	Event(Signup)
+
+	if testutil.ToFloat64(events.WithLabelValues(Signup)) != before+1 {
+		t.Error("Signup counter should be incremented")
+	}
+}
+
+func TestObserveUpload(t *testing.T) {
+	bytesBefore := testutil.ToFloat64(uploadBytes)
+	errorsBefore := testutil.ToFloat64(uploads.WithLabelValues("error"))
+
+	ObserveUpload(10, nil)
+	ObserveUpload(5, errors.New("failed"))
+
+	if testutil.ToFloat64(uploadBytes) != bytesBefore+15 {
+		t.Error("Uploaded bytes should be added")
+	}
+
+	if testutil.ToFloat64(uploads.WithLabelValues("error")) != errorsBefore+1 {
+		t.Error("Failed uploads should be counted")
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+// RewardAnalytics summarizes how a reward tier is doing
+type RewardAnalytics struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Backers   int    `json:"backers"`
+	Remaining *int   `json:"remaining,omitempty"`
+}
+
+// ProjectAnalytics summarizes the activity of a project for its team
+type ProjectAnalytics struct {
+	Views             int               `json:"views"`
+	Votes             int               `json:"votes"`
+	Comments          int               `json:"comments"`
+	Contributions     int               `json:"contributions"`
+	Backers           int               `json:"backers"`
+	Funding           float32           `json:"funding"`
+	Goal              float32           `json:"goal"`
+	FundingPercentage float64           `json:"funding_percentage"`
+	AverageAmount     float32           `json:"average_amount"`
+	Rewards           []RewardAnalytics `json:"rewards"`
+}
+
+// Analytics computes the activity summary of a project
+func (p Project) Analytics() ProjectAnalytics {
+	p.computeFunding()
+	analytics := ProjectAnalytics{
+		Views:             p.Views,
+		Votes:             len(p.Votes),
+		Comments:          len(p.Comments),
+		Contributions:     len(p.Contributions),
+		Funding:           p.Funding,
+		Goal:              p.Goal,
+		FundingPercentage: p.FundingPercentage,
+		Rewards:           make([]RewardAnalytics, 0, len(p.Rewards)),
+	}
+
+	backers := make(map[string]bool)
+	for _, contribution := range p.Contributions {
+		backers[contribution.User.ID.Hex()] = true
+	}
+	analytics.Backers = len(backers)
+	if analytics.Contributions > 0 {
+		analytics.AverageAmount = p.Funding / float32(analytics.Contributions)
+	}
+
+	for _, reward := range p.Rewards {
+		analytics.Rewards = append(analytics.Rewards, RewardAnalytics{reward.ID.Hex(), reward.Title, reward.Backers, reward.Remaining})
+	}
+	return analytics
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Campaign statuses of a project
+const (
+	StatusDraft     = "draft"
+	StatusActive    = "active"
+	StatusFunded    = "funded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// transitions lists the statuses a project can move to from each status
+var transitions = map[string][]string{
+	StatusDraft:  {StatusActive, StatusCancelled},
+	StatusActive: {StatusFunded, StatusFailed, StatusCancelled},
+}
+
+var (
+	// ErrInvalidTransition is returned when a project can't move to the requested status
+	ErrInvalidTransition = errors.New("Invalid status transition")
+	// ErrCampaignNotActive is returned when contributing outside the active window of a campaign
+	ErrCampaignNotActive = errors.New("Project is not accepting contributions")
+	// ErrInvalidAmount is returned for contributions that are not positive
+	ErrInvalidAmount = errors.New("Contribution amount must be greater than zero")
+	// ErrNoGoal is returned when activating a campaign without a funding goal
+	ErrNoGoal = errors.New("Campaigns need a goal greater than zero to be active")
+)
+
+const day = 24 * time.Hour
+
+// CanTransition checks if a project in status from can move to status to
+func CanTransition(from, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusesBefore returns the statuses that can move to status
+func statusesBefore(status string) []string {
+	before := make([]string, 0)
+	for from := range transitions {
+		if CanTransition(from, status) {
+			before = append(before, from)
+		}
+	}
+	return before
+}
+
+// schedule sets the campaign window starting at start and lasting the project duration in days
+func (p *Project) schedule(start time.Time) {
+	p.StartsAt = start
+	p.EndsAt = time.Time{}
+	if p.Duration > 0 {
+		p.EndsAt = start.Add(time.Duration(p.Duration) * day)
+	}
+}
+
+// computeFunding sets the percentage of the goal that has been funded
+func (p *Project) computeFunding() {
+	p.FundingPercentage = 0
+	if p.Goal > 0 {
+		p.FundingPercentage = float64(p.Funding) / float64(p.Goal) * 100
+	}
+}
+
+// endsAtExpression computes the end of a campaign starting at start in an update pipeline,
+// campaigns without a duration don't end
+func endsAtExpression(start interface{}) bson.M {
+	durationMs := bson.M{"$multiply": bson.A{"$duration", int64(day / time.Millisecond)}}
+	return bson.M{"$cond": bson.A{
+		bson.M{"$gt": bson.A{"$duration", 0}},
+		bson.M{"$add": bson.A{start, durationMs}},
+		nil,
+	}}
+}
+
+// activeWindow matches the projects currently accepting contributions
+func activeWindow(now time.Time) bson.M {
+	return bson.M{
+		"status":    StatusActive,
+		"starts_at": bson.M{"$lte": now},
+		"$or":       bson.A{bson.M{"ends_at": bson.M{"$gt": now}}, bson.M{"ends_at": nil}},
+	}
+}
+
+// Transition moves a project to a new status if the state machine allows it
+func (ps *ProjectStore) Transition(ctx context.Context, id, status string) error {
+	defer metrics.ObserveStore("projects", "Transition", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": oid, "status": bson.M{"$in": statusesBefore(status)}}
+	set := bson.M{"status": status}
+	if status == StatusActive {
+		// A campaign without a goal would be funded as soon as it ends
+		filter["goal"] = bson.M{"$gt": 0}
+
+		// Launching starts the campaign window now
+		now := time.Now()
+		set["starts_at"] = now
+		set["ends_at"] = endsAtExpression(now)
+	}
+
+	update := bson.A{bson.M{"$set": set}}
+	if status == StatusActive {
+		update = append(update, bson.M{"$unset": "publish_at"})
+	}
+
+	var previous Project
+	updateOptions := options.FindOneAndUpdate().SetProjection(bson.M{"tags": 1, "status": 1})
+	err = ps.collection.FindOneAndUpdate(ctx, matchAll(filter, notDeleted), update, updateOptions).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		if err := ps.exists(ctx, oid); err != nil {
+			return err
+		}
+		if status == StatusActive {
+			count, err := ps.collection.CountDocuments(ctx, matchAll(bson.M{"_id": oid, "status": filter["status"]}, notDeleted))
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrNoGoal
+			}
+		}
+		return ErrInvalidTransition
+	}
+	if err != nil {
+		return err
+	}
+
+	if previous.Status == StatusDraft {
+		// Tags of drafts are counted once they leave the draft status
+		ps.trackTags(ctx, previous.Tags, nil)
+	}
+	return nil
+}
+
+// exists checks if there is a project with a given id
+func (ps *ProjectStore) exists(ctx context.Context, oid primitive.ObjectID) error {
+	count, err := ps.collection.CountDocuments(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("No project found with given id")
+	}
+	return nil
+}
+
+// MigrateCampaigns sets the campaign fields of projects created before campaigns had a status:
+// the ones with a goal become active from their creation date, the rest become drafts until
+// their owner sets a goal. Their funding is the sum of their contributions
+func (ps *ProjectStore) MigrateCampaigns(ctx context.Context) (int64, error) {
+	defer metrics.ObserveStore("projects", "MigrateCampaigns", time.Now())
+
+	hasGoal := bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$goal", 0}}, 0}}
+	ifGoal := func(value interface{}, otherwise interface{}) bson.M {
+		return bson.M{"$cond": bson.A{hasGoal, value, otherwise}}
+	}
+	update := bson.A{bson.M{"$set": bson.M{
+		"status":    ifGoal(StatusActive, StatusDraft),
+		"starts_at": ifGoal("$created_at", "$$REMOVE"),
+		"ends_at":   ifGoal(endsAtExpression("$created_at"), "$$REMOVE"),
+		"funding":   bson.M{"$sum": "$contributions.amount"},
+	}}}
+	result, err := ps.collection.UpdateMany(ctx, bson.M{"status": bson.M{"$exists": false}}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ClosedCampaign is a campaign closed when its window ended, with the users to notify
+type ClosedCampaign struct {
+	ID           primitive.ObjectID
+	Title        string
+	Status       string
+	Owner        primitive.ObjectID
+	Contributors []primitive.ObjectID
+}
+
+// closingStatus returns the status of an ended campaign, funded when it reached its goal.
+// Campaigns without a goal can't reach it
+func closingStatus(p Project) string {
+	if p.Goal > 0 && p.Funding >= p.Goal {
+		return StatusFunded
+	}
+	return StatusFailed
+}
+
+// CloseEndedCampaigns marks the active campaigns whose window ended before now as funded or failed
+func (ps *ProjectStore) CloseEndedCampaigns(ctx context.Context, now time.Time) ([]ClosedCampaign, error) {
+	defer metrics.ObserveStore("projects", "CloseEndedCampaigns", time.Now())
+
+	ended := bson.M{"status": StatusActive, "ends_at": bson.M{"$lte": now}, "deleted_at": bson.M{"$exists": false}}
+	projection := bson.M{"title": 1, "owner": 1, "goal": 1, "funding": 1, "contributions.user._id": 1}
+	cursor, err := ps.collection.Find(ctx, ended, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	closed := make([]ClosedCampaign, 0)
+	for cursor.Next(ctx) {
+		var project Project
+		if err := cursor.Decode(&project); err != nil {
+			return closed, err
+		}
+
+		status := closingStatus(project)
+		result, err := ps.collection.UpdateOne(ctx, matchAll(bson.M{"_id": project.ID}, ended), bson.M{"$set": bson.M{"status": status}})
+		if err != nil {
+			return closed, err
+		}
+		if result.ModifiedCount == 0 {
+			// Closed or cancelled concurrently
+			continue
+		}
+
+		campaign := ClosedCampaign{ID: project.ID, Title: project.Title, Status: status, Owner: project.Owner}
+		for _, contribution := range project.Contributions {
+			campaign.Contributors = append(campaign.Contributors, contribution.User.ID)
+		}
+		closed = append(closed, campaign)
+	}
+
+	return closed, cursor.Err()
+}
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultLanguage is the language of the category names shown when the requested one is missing
+const DefaultLanguage = "es"
+
+var (
+	// ErrUnknownCategory is returned when a project uses a category that doesn't exist
+	ErrUnknownCategory = errors.New("Unknown category")
+	// ErrCategoryNotFound is returned when there is no category with the given slug
+	ErrCategoryNotFound = errors.New("No category found with given slug")
+	// ErrCategoryExists is returned when creating a category with a slug already in use
+	ErrCategoryExists = errors.New("A category with that slug already exists")
+	// ErrCategoryInUse is returned when deleting a category that has projects or subcategories
+	ErrCategoryInUse = errors.New("The category has projects or subcategories")
+)
+
+// Category is a project category managed by admins. Names holds the name in each language
+type Category struct {
+	Slug        string            `json:"slug" bson:"_id"`
+	Names       map[string]string `json:"names" bson:"names"`
+	Name        string            `json:"name,omitempty" bson:"-"`
+	Description string            `json:"description,omitempty" bson:"description,omitempty"`
+	Icon        string            `json:"icon,omitempty" bson:"icon,omitempty"`
+	Parent      string            `json:"parent,omitempty" bson:"parent,omitempty"`
+	Order       int               `json:"order" bson:"order"`
+	Projects    int64             `json:"projects" bson:"-"`
+}
+
+// Validate checks the slug is URL-safe and the category has a name
+func (c Category) Validate() error {
+	if c.Slug == "" || Slugify(c.Slug) != c.Slug {
+		return errors.New("Invalid slug, use lowercase letters, digits and dashes")
+	}
+	if strings.TrimSpace(c.Names[DefaultLanguage]) == "" {
+		return errors.New("The category needs a name in " + DefaultLanguage)
+	}
+	if c.Parent == c.Slug {
+		return errors.New("A category can't be its own parent")
+	}
+	return nil
+}
+
+// Localize sets Name to the name in the given language, or in the default one if it's missing
+func (c *Category) Localize(language string) {
+	c.Name = c.Names[language]
+	if c.Name == "" {
+		c.Name = c.Names[DefaultLanguage]
+	}
+}
+
+// CategoryStore contains the operations on project categories
+type CategoryStore struct {
+	database   *mongo.Database
+	collection *mongo.Collection
+}
+
+// NewCategoryStore creates a category store with a mongo database
+func NewCategoryStore(database *mongo.Database) *CategoryStore {
+	return &CategoryStore{database, database.Collection("categories")}
+}
+
+// CreateIndexes creates the indexes used to list categories if they don't exist
+func (cs *CategoryStore) CreateIndexes(ctx context.Context) error {
+	_, err := cs.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "parent", Value: 1}, {Key: "order", Value: 1}},
+	})
+	return err
+}
+
+// Create stores a new category
+func (cs *CategoryStore) Create(ctx context.Context, category Category) error {
+	defer metrics.ObserveStore("categories", "Create", time.Now())
+
+	if err := cs.checkParent(ctx, category); err != nil {
+		return err
+	}
+
+	_, err := cs.collection.InsertOne(ctx, category)
+	if isDuplicateKey(err) {
+		return ErrCategoryExists
+	}
+	return err
+}
+
+// Update replaces the names, description, icon, parent and order of a category
+func (cs *CategoryStore) Update(ctx context.Context, category Category) error {
+	defer metrics.ObserveStore("categories", "Update", time.Now())
+
+	if err := cs.checkParent(ctx, category); err != nil {
+		return err
+	}
+
+	result, err := cs.collection.ReplaceOne(ctx, bson.M{"_id": category.Slug}, category)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// Delete removes a category that no project or subcategory uses
+func (cs *CategoryStore) Delete(ctx context.Context, slug string) error {
+	defer metrics.ObserveStore("categories", "Delete", time.Now())
+
+	children, err := cs.collection.CountDocuments(ctx, bson.M{"parent": slug})
+	if err != nil {
+		return err
+	}
+	projects, err := NewProjectStore(cs.database).collection.CountDocuments(ctx, bson.M{"category": slug})
+	if err != nil {
+		return err
+	}
+	if children > 0 || projects > 0 {
+		return ErrCategoryInUse
+	}
+
+	result, err := cs.collection.DeleteOne(ctx, bson.M{"_id": slug})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns every category in order, named in the given language and with the number
+// of published projects in it
+func (cs *CategoryStore) GetAll(ctx context.Context, language string) ([]Category, error) {
+	defer metrics.ObserveStore("categories", "GetAll", time.Now())
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := cs.collection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make([]Category, 0)
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	counts, err := cs.projectCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for index := range categories {
+		categories[index].Localize(language)
+		categories[index].Projects = counts[categories[index].Slug]
+	}
+	return categories, nil
+}
+
+// Exists checks if there is a category with the given slug
+func (cs *CategoryStore) Exists(ctx context.Context, slug string) (bool, error) {
+	defer metrics.ObserveStore("categories", "Exists", time.Now())
+
+	count, err := cs.collection.CountDocuments(ctx, bson.M{"_id": slug})
+	return count > 0, err
+}
+
+// projectCounts returns the number of published projects per category
+func (cs *CategoryStore) projectCounts(ctx context.Context) (map[string]int64, error) {
+	pipeline := bson.A{
+		bson.M{"$match": published},
+		bson.M{"$group": bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}},
+	}
+	cursor, err := NewProjectStore(cs.database).collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []FacetCount
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(results))
+	for _, result := range results {
+		counts[result.Value] = result.Count
+	}
+	return counts, nil
+}
+
+// Descendants returns the given categories followed by every category below them
+func (cs *CategoryStore) Descendants(ctx context.Context, slugs []string) ([]string, error) {
+	defer metrics.ObserveStore("categories", "Descendants", time.Now())
+
+	cursor, err := cs.collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"parent": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return descendants(categories, slugs), nil
+}
+
+// descendants walks the category tree down from slugs, each category is returned once
+func descendants(categories []Category, slugs []string) []string {
+	children := make(map[string][]string)
+	for _, category := range categories {
+		if category.Parent != "" {
+			children[category.Parent] = append(children[category.Parent], category.Slug)
+		}
+	}
+
+	result := make([]string, 0, len(slugs))
+	seen := make(map[string]bool)
+	pending := append([]string{}, slugs...)
+	for len(pending) > 0 {
+		slug := pending[0]
+		pending = pending[1:]
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		result = append(result, slug)
+		pending = append(pending, children[slug]...)
+	}
+	return result
+}
+
+// checkParent verifies the parent of a category exists and doesn't descend from it
+func (cs *CategoryStore) checkParent(ctx context.Context, category Category) error {
+	for parent := category.Parent; parent != ""; {
+		if parent == category.Slug {
+			return errors.New("A category can't descend from itself")
+		}
+
+		var ancestor Category
+		if err := cs.collection.FindOne(ctx, bson.M{"_id": parent}).Decode(&ancestor); err != nil {
+			return errors.New("Unknown parent category")
+		}
+		parent = ancestor.Parent
+	}
+	return nil
+}
+
+// checkCategory verifies a project category exists, projects may have no category while drafts
+func (ps *ProjectStore) checkCategory(ctx context.Context, slug string) error {
+	if slug == "" {
+		return nil
+	}
+	exists, err := NewCategoryStore(ps.database).Exists(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUnknownCategory
+	}
+	return nil
+}
+
+// MigrateCategories creates a category for each free-form category of the existing projects
+// and moves the projects to it, returning how many projects were moved. Values that can't
+// make a valid category, like those without letters or digits, are skipped and returned
+func (ps *ProjectStore) MigrateCategories(ctx context.Context) (migrated int64, skipped []string, err error) {
+	defer metrics.ObserveStore("projects", "MigrateCategories", time.Now())
+
+	values, err := ps.collection.Distinct(ctx, "category", bson.M{"category": bson.M{"$nin": bson.A{"", nil}}})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	categoryStore := NewCategoryStore(ps.database)
+	for _, value := range values {
+		name, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		category := migratedCategory(name)
+		if err := category.Validate(); err != nil {
+			skipped = append(skipped, name)
+			continue
+		}
+
+		slug := category.Slug
+		exists, err := categoryStore.Exists(ctx, slug)
+		if err != nil {
+			return migrated, skipped, err
+		}
+		if !exists {
+			if err := categoryStore.Create(ctx, category); err != nil && err != ErrCategoryExists {
+				return migrated, skipped, err
+			}
+		}
+
+		if slug == name {
+			continue
+		}
+		result, err := ps.collection.UpdateMany(ctx, bson.M{"category": name}, bson.M{"$set": bson.M{"category": slug}})
+		if err != nil {
+			return migrated, skipped, err
+		}
+		migrated += result.ModifiedCount
+	}
+	return migrated, skipped, nil
+}
+
+// migratedCategory is the category created for a free-form category name. Its slug is
+// empty when the name has no letters or digits
+func migratedCategory(name string) Category {
+	return Category{Slug: slugWords(name), Names: map[string]string{DefaultLanguage: strings.TrimSpace(name)}}
+}
@@ -12,6 +12,7 @@ type Contribution struct {
 	User   ContributionUser   `json:"user,omitempty" bson:"user,omitempty"`
 	Amount float32            `json:"amount,omitempty" bson:"amount,omitempty"`
 	Date   time.Time          `json:"date,omitempty" bson:"date,omitempty"`
+	Reward primitive.ObjectID `json:"reward_id,omitempty" bson:"reward,omitempty"`
 }
 
 // ContributionUser helps model a user inside a contribution
@@ -0,0 +1,276 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrCollectionNotFound is returned when there is no curated collection with the given id or slug
+	ErrCollectionNotFound = errors.New("No collection found")
+	// ErrCollectionExists is returned when a curated collection uses a slug already taken
+	ErrCollectionExists = errors.New("A collection with that slug already exists")
+)
+
+// CuratedCollection is a list of projects picked by staff, such as "Staff picks". It is only
+// shown between StartsAt and EndsAt when they are set
+type CuratedCollection struct {
+	ID          primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Slug        string               `json:"slug" bson:"slug"`
+	Title       string               `json:"title" bson:"title"`
+	Description string               `json:"description,omitempty" bson:"description,omitempty"`
+	Projects    []primitive.ObjectID `json:"projects" bson:"projects"`
+	Order       int                  `json:"order" bson:"order"`
+	StartsAt    time.Time            `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	EndsAt      time.Time            `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+}
+
+// EditCollection holds the fields of a curated collection admins can set. The slug defaults
+// to the slug of the title, and the projects are shown in the given order
+type EditCollection struct {
+	Slug        string     `json:"slug,omitempty"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Projects    []string   `json:"projects"`
+	Order       int        `json:"order,omitempty"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+}
+
+// Validate checks the collection values and defaults the slug
+func (ec *EditCollection) Validate() error {
+	if strings.TrimSpace(ec.Title) == "" {
+		return errors.New("Collection title is required")
+	}
+	if ec.Slug == "" {
+		ec.Slug = slugWords(ec.Title)
+		if ec.Slug == "" {
+			return errors.New("The title has no letters or digits for a slug, set one")
+		}
+	} else if Slugify(ec.Slug) != ec.Slug {
+		return errors.New("Invalid slug, use lowercase letters, digits and dashes")
+	}
+	if ec.StartsAt != nil && ec.EndsAt != nil && !ec.EndsAt.After(*ec.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	seen := make(map[string]bool, len(ec.Projects))
+	for _, id := range ec.Projects {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			return errors.New("Invalid project id " + id)
+		}
+		if seen[id] {
+			return errors.New("Project " + id + " is repeated")
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// collection builds the stored collection from the edited values
+func (ec EditCollection) collection() CuratedCollection {
+	collection := CuratedCollection{
+		Slug:        ec.Slug,
+		Title:       strings.TrimSpace(ec.Title),
+		Description: ec.Description,
+		Projects:    make([]primitive.ObjectID, 0, len(ec.Projects)),
+		Order:       ec.Order,
+	}
+	for _, id := range ec.Projects {
+		oid, _ := primitive.ObjectIDFromHex(id)
+		collection.Projects = append(collection.Projects, oid)
+	}
+	if ec.StartsAt != nil {
+		collection.StartsAt = *ec.StartsAt
+	}
+	if ec.EndsAt != nil {
+		collection.EndsAt = *ec.EndsAt
+	}
+	return collection
+}
+
+// showing matches the collections whose scheduling window includes now
+func showing(now time.Time) bson.M {
+	return matchAll(
+		bson.M{"$or": bson.A{bson.M{"starts_at": bson.M{"$exists": false}}, bson.M{"starts_at": bson.M{"$lte": now}}}},
+		bson.M{"$or": bson.A{bson.M{"ends_at": bson.M{"$exists": false}}, bson.M{"ends_at": bson.M{"$gt": now}}}},
+	)
+}
+
+// CurationStore contains the operations on curated collections
+type CurationStore struct {
+	database   *mongo.Database
+	collection *mongo.Collection
+}
+
+// NewCurationStore creates a curated collection store with a mongo database
+func NewCurationStore(database *mongo.Database) *CurationStore {
+	return &CurationStore{database, database.Collection("curated_collections")}
+}
+
+// CreateIndexes creates the indexes used to find collections if they don't exist
+func (cs *CurationStore) CreateIndexes(ctx context.Context) error {
+	_, err := cs.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "order", Value: 1}}},
+	})
+	return err
+}
+
+// Create stores a new curated collection
+func (cs *CurationStore) Create(ctx context.Context, ec EditCollection) (CuratedCollection, error) {
+	defer metrics.ObserveStore("collections", "Create", time.Now())
+
+	collection := ec.collection()
+	if err := cs.checkProjects(ctx, collection.Projects); err != nil {
+		return CuratedCollection{}, err
+	}
+
+	collection.CreatedAt = time.Now()
+	result, err := cs.collection.InsertOne(ctx, collection)
+	if isDuplicateKey(err) {
+		return CuratedCollection{}, ErrCollectionExists
+	}
+	if err != nil {
+		return CuratedCollection{}, err
+	}
+
+	generatedID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return CuratedCollection{}, errors.New("Invalid generated id on collection")
+	}
+	collection.ID = generatedID
+	return collection, nil
+}
+
+// Update replaces the values of a curated collection
+func (cs *CurationStore) Update(ctx context.Context, id string, ec EditCollection) (CuratedCollection, error) {
+	defer metrics.ObserveStore("collections", "Update", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return CuratedCollection{}, ErrCollectionNotFound
+	}
+
+	collection := ec.collection()
+	if err := cs.checkProjects(ctx, collection.Projects); err != nil {
+		return CuratedCollection{}, err
+	}
+
+	set := bson.M{
+		"slug":        collection.Slug,
+		"title":       collection.Title,
+		"description": collection.Description,
+		"projects":    collection.Projects,
+		"order":       collection.Order,
+		"updated_at":  time.Now(),
+	}
+	unset := bson.M{}
+	for field, value := range map[string]time.Time{"starts_at": collection.StartsAt, "ends_at": collection.EndsAt} {
+		if value.IsZero() {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var updated CuratedCollection
+	updateOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = cs.collection.FindOneAndUpdate(ctx, bson.M{"_id": oid}, update, updateOptions).Decode(&updated)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return CuratedCollection{}, ErrCollectionNotFound
+	case isDuplicateKey(err):
+		return CuratedCollection{}, ErrCollectionExists
+	case err != nil:
+		return CuratedCollection{}, err
+	}
+	return updated, nil
+}
+
+// Delete removes a curated collection
+func (cs *CurationStore) Delete(ctx context.Context, id string) error {
+	defer metrics.ObserveStore("collections", "Delete", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrCollectionNotFound
+	}
+
+	result, err := cs.collection.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrCollectionNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns the curated collections in order, only the ones showing now unless all is true
+func (cs *CurationStore) GetAll(ctx context.Context, now time.Time, all bool) ([]CuratedCollection, error) {
+	defer metrics.ObserveStore("collections", "GetAll", time.Now())
+
+	filter := showing(now)
+	if all {
+		filter = bson.M{}
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := cs.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	collections := make([]CuratedCollection, 0)
+	err = cursor.All(ctx, &collections)
+	return collections, err
+}
+
+// GetProjects returns a page of the published projects of a collection showing now, in the
+// collection order
+func (cs *CurationStore) GetProjects(ctx context.Context, slug string, now time.Time, page Page) (ProjectPage, error) {
+	defer metrics.ObserveStore("collections", "GetProjects", time.Now())
+
+	var collection CuratedCollection
+	err := cs.collection.FindOne(ctx, matchAll(bson.M{"slug": slug}, showing(now))).Decode(&collection)
+	if err == mongo.ErrNoDocuments {
+		return ProjectPage{}, ErrCollectionNotFound
+	}
+	if err != nil {
+		return ProjectPage{}, err
+	}
+
+	return NewProjectStore(cs.database).rankedPage(ctx, collection.Projects, published, page)
+}
+
+// checkProjects verifies every project of a collection exists
+func (cs *CurationStore) checkProjects(ctx context.Context, ids []primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	count, err := NewProjectStore(cs.database).collection.CountDocuments(ctx, matchAll(bson.M{"_id": bson.M{"$in": ids}}, notDeleted))
+	if err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return errors.New("Some projects of the collection don't exist")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// earthRadiusKm is the equatorial radius of the Earth, the one MongoDB uses for spherical
+// distances, so the distances computed here match the ones of $geoNear
+const earthRadiusKm = 6378.1
+
+// geoIndex lets the projects be searched by their coordinates
+var geoIndex = mongo.IndexModel{Keys: bson.D{{Key: "geo", Value: "2dsphere"}}}
+
+// GeoPoint is a GeoJSON point, its coordinates are the longitude and the latitude in that order
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// NewGeoPoint creates a GeoJSON point from a longitude and a latitude
+func NewGeoPoint(lng, lat float64) GeoPoint {
+	return GeoPoint{"Point", []float64{lng, lat}}
+}
+
+// Validate checks the point is a GeoJSON point with a valid longitude and latitude
+func (g GeoPoint) Validate() error {
+	if g.Type != "Point" || len(g.Coordinates) != 2 {
+		return errors.New("Coordinates must be a GeoJSON point with longitude and latitude")
+	}
+	return validCoordinates(g.Coordinates[0], g.Coordinates[1])
+}
+
+func validCoordinates(lng, lat float64) error {
+	if lng < -180 || lng > 180 || lat < -90 || lat > 90 {
+		return errors.New("Longitude must be between -180 and 180 and latitude between -90 and 90")
+	}
+	return nil
+}
+
+// GeoNear selects the projects around a point, within RadiusKm when it is set
+type GeoNear struct {
+	Lng      float64 `json:"lng"`
+	Lat      float64 `json:"lat"`
+	RadiusKm float64 `json:"radius_km,omitempty"`
+}
+
+// Validate checks the point and the radius
+func (n GeoNear) Validate() error {
+	if n.RadiusKm < 0 {
+		return errors.New("radius_km can't be negative")
+	}
+	return validCoordinates(n.Lng, n.Lat)
+}
+
+func (n GeoNear) filter() bson.M {
+	if n.RadiusKm == 0 {
+		return bson.M{"geo": bson.M{"$exists": true}}
+	}
+	return bson.M{"geo": bson.M{"$geoWithin": bson.M{
+		"$centerSphere": bson.A{bson.A{n.Lng, n.Lat}, n.RadiusKm / earthRadiusKm},
+	}}}
+}
+
+// stage returns a $geoNear stage that selects the projects matching filter around the point
+// using the 2dsphere index and sets their distance in km. It must be the first stage of a
+// pipeline and filter can't have a text search
+func (n GeoNear) stage(filter bson.M) bson.M {
+	near := bson.M{
+		"near":               NewGeoPoint(n.Lng, n.Lat),
+		"key":                "geo",
+		"distanceField":      "distance",
+		"distanceMultiplier": 0.001,
+		"spherical":          true,
+		"query":              filter,
+	}
+	if n.RadiusKm > 0 {
+		near["maxDistance"] = n.RadiusKm * 1000
+	}
+	return bson.M{"$geoNear": near}
+}
+
+// distance computes the distance in km from the point to the project coordinates with the
+// haversine formula, for the text searches that can't use $geoNear
+func (n GeoNear) distance() bson.M {
+	radians := func(value interface{}) bson.M { return bson.M{"$degreesToRadians": value} }
+	lng := radians(bson.M{"$arrayElemAt": bson.A{"$geo.coordinates", 0}})
+	lat := radians(bson.M{"$arrayElemAt": bson.A{"$geo.coordinates", 1}})
+	halfSin := func(a, b interface{}) bson.M {
+		return bson.M{"$sin": bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{a, b}}, 2}}}
+	}
+	square := func(value interface{}) bson.M { return bson.M{"$pow": bson.A{value, 2}} }
+
+	h := bson.M{"$add": bson.A{
+		square(halfSin(lat, radians(n.Lat))),
+		bson.M{"$multiply": bson.A{
+			bson.M{"$cos": radians(n.Lat)}, bson.M{"$cos": lat}, square(halfSin(lng, radians(n.Lng))),
+		}},
+	}}
+	return bson.M{"$multiply": bson.A{2 * earthRadiusKm, bson.M{"$asin": bson.M{"$sqrt": h}}}}
+}
+
+// GeoBox selects the projects inside a bounding box given by its south west and north east
+// corners, each as longitude and latitude
+type GeoBox struct {
+	SouthWest [2]float64 `json:"south_west"`
+	NorthEast [2]float64 `json:"north_east"`
+}
+
+// Validate checks the corners of the box
+func (b GeoBox) Validate() error {
+	if err := validCoordinates(b.SouthWest[0], b.SouthWest[1]); err != nil {
+		return err
+	}
+	if err := validCoordinates(b.NorthEast[0], b.NorthEast[1]); err != nil {
+		return err
+	}
+	if b.SouthWest[0] >= b.NorthEast[0] || b.SouthWest[1] >= b.NorthEast[1] {
+		return errors.New("south_west must be below and to the left of north_east")
+	}
+	return nil
+}
+
+// boxEdgeStep is the largest longitude span, in degrees, between the vertices of the box
+// edges that follow a latitude
+const boxEdgeStep = 1.0
+
+// strictWinding is the coordinate system of polygons bigger than a hemisphere, their inside
+// is on the left of the counterclockwise ring
+var strictWinding = bson.M{"type": "name", "properties": bson.M{"name": "urn:x-mongodb:crs:strictwinding:EPSG:4326"}}
+
+// filter matches the points inside the box with $geoWithin so the 2dsphere index is used
+func (b GeoBox) filter() bson.M {
+	return bson.M{"geo": bson.M{"$geoWithin": bson.M{"$geometry": bson.M{
+		"type":        "Polygon",
+		"coordinates": bson.A{b.ring()},
+		"crs":         strictWinding,
+	}}}}
+}
+
+// ring returns the counterclockwise outline of the box. MongoDB draws polygon edges as
+// great-circle arcs, so the south and north edges get a vertex every boxEdgeStep degrees
+// to stay close to their latitude, the straight line seen on the map
+func (b GeoBox) ring() bson.A {
+	west, south := b.SouthWest[0], b.SouthWest[1]
+	east, north := b.NorthEast[0], b.NorthEast[1]
+
+	steps := int(math.Ceil((east - west) / boxEdgeStep))
+	ring := make(bson.A, 0, 2*steps+3)
+	for step := 0; step <= steps; step++ {
+		ring = append(ring, bson.A{math.Min(west+float64(step)*boxEdgeStep, east), south})
+	}
+	for step := 0; step <= steps; step++ {
+		ring = append(ring, bson.A{math.Max(east-float64(step)*boxEdgeStep, west), north})
+	}
+	return append(ring, bson.A{west, south})
+}
+
+func decodeGeoPoint(raw json.RawMessage) (interface{}, error) {
+	var point GeoPoint
+	if err := json.Unmarshal(raw, &point); err != nil {
+		return nil, errors.New("must be a GeoJSON point")
+	}
+	if err := point.Validate(); err != nil {
+		return nil, err
+	}
+	return point, nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	jobLeasesCollection = "job_leases"
+	jobRunsCollection   = "job_runs"
+)
+
+// Results of a job run
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRun is the record of a scheduled job execution
+type JobRun struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Job        string             `json:"job" bson:"job"`
+	Instance   string             `json:"instance" bson:"instance"`
+	StartedAt  time.Time          `json:"started_at" bson:"started_at"`
+	FinishedAt time.Time          `json:"finished_at" bson:"finished_at"`
+	Status     string             `json:"status" bson:"status"`
+	Result     string             `json:"result,omitempty" bson:"result,omitempty"`
+	Error      string             `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// JobStore keeps the leases that let a single replica run each job and the history of runs
+type JobStore struct {
+	leases *mongo.Collection
+	runs   *mongo.Collection
+}
+
+// NewJobStore creates a job store with a mongo database
+func NewJobStore(database *mongo.Database) *JobStore {
+	return &JobStore{database.Collection(jobLeasesCollection), database.Collection(jobRunsCollection)}
+}
+
+// jobRunRetention is how long the history of job runs is kept
+const jobRunRetention = 30 * 24 * time.Hour
+
+// CreateIndexes creates the indexes used to list job runs and the one that expires old runs
+// if they don't exist
+func (js *JobStore) CreateIndexes(ctx context.Context) error {
+	_, err := js.runs.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "started_at", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "finished_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(jobRunRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+// AcquireLease takes the lease of a job for ttl if it is free or expired. The lease is
+// kept until it expires, so a job runs at most once per ttl across all the replicas
+func (js *JobStore) AcquireLease(ctx context.Context, job, instance string, ttl time.Duration) (bool, error) {
+	defer metrics.ObserveStore("jobs", "AcquireLease", time.Now())
+
+	now := time.Now()
+	filter := bson.M{"_id": job, "expires_at": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"instance": instance, "acquired_at": now, "expires_at": now.Add(ttl)}}
+	_, err := js.leases.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if isDuplicateKey(err) {
+		// Another replica holds a lease that hasn't expired
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RecordRun stores the result of a job run
+func (js *JobStore) RecordRun(ctx context.Context, run JobRun) error {
+	defer metrics.ObserveStore("jobs", "RecordRun", time.Now())
+
+	_, err := js.runs.InsertOne(ctx, run)
+	return err
+}
+
+// GetRuns returns the latest runs, of every job when job is empty
+func (js *JobStore) GetRuns(ctx context.Context, job string, limit int64) ([]JobRun, error) {
+	defer metrics.ObserveStore("jobs", "GetRuns", time.Now())
+
+	filter := bson.M{}
+	if job != "" {
+		filter["job"] = job
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(limit)
+	cursor, err := js.runs.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	runs := make([]JobRun, 0)
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// isDuplicateKey reports if a write failed because of a unique index
+func isDuplicateKey(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, writeError := range e.WriteErrors {
+			if writeError.Code == 11000 {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == 11000
+	}
+	return false
+}
@@ -1,13 +1,19 @@
 package models
 
 import (
+	"context"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/jpr98/apis_pf_back/datastore"
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestGetCommentsAuthors(t *testing.T) {
@@ -123,3 +129,560 @@ func TestCreate(t *testing.T) {
 		t.Error("Text should be set in comment")
 	}
 }
+
+func TestPageLimit(t *testing.T) {
+	if (Page{}).limit() != DefaultPageLimit {
+		t.Error("Empty page should use the default limit")
+	}
+
+	if (Page{Limit: MaxPageLimit + 1}).limit() != MaxPageLimit {
+		t.Error("Page limit should be capped")
+	}
+}
+
+func TestCursor(t *testing.T) {
+	id := primitive.NewObjectID()
+	cursor, err := encodeCursor("votes_count", bson.RawValue{}, id)
+	if err != nil {
+		t.Fatal("Cursor should be encoded", err)
+	}
+
+	if !ValidCursor(cursor) {
+		t.Error("Encoded cursor should be valid")
+	}
+
+	if ValidCursor("not a cursor") {
+		t.Error("Random strings should not be valid cursors")
+	}
+
+	pc, _ := decodeCursor(cursor)
+	if pc.ID != id {
+		t.Error("Cursor should keep the last id")
+	}
+
+	after := pageSort{"votes_count", -1}.after(pc)
+	if _, ok := after["$or"]; ok {
+		t.Error("Only projects without votes_count come after a null value in descending order")
+	}
+}
+
+func TestLiteralPattern(t *testing.T) {
+	pattern := literalPattern("Canción (a+)+")
+	re := regexp.MustCompile("(?i)" + pattern)
+	if !re.MatchString("La cancion (a+)+ del año") {
+		t.Error("Pattern should match the text literally and without accents")
+	}
+
+	if re.MatchString("Canción aaaa") {
+		t.Error("Regex characters should be escaped")
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	if len(matchAll(bson.M{}, bson.M{})) != 0 {
+		t.Error("Empty filters should match everything")
+	}
+
+	filter := matchAll(bson.M{}, bson.M{"category": "arte"})
+	if filter["category"] != "arte" {
+		t.Error("A single filter should be returned as is")
+	}
+
+	filter = matchAll(bson.M{"category": "arte"}, bson.M{"tags": "musica"})
+	if len(filter["$and"].(bson.A)) != 2 {
+		t.Error("Filters should be combined with $and")
+	}
+}
+
+func TestProjectQueryValidate(t *testing.T) {
+	if err := (ProjectQuery{Sort: SortMostFunded}).Validate(); err != nil {
+		t.Error("Known sorts should be valid")
+	}
+
+	if err := (ProjectQuery{Sort: "random"}).Validate(); err == nil {
+		t.Error("Unknown sorts should be rejected")
+	}
+
+	min, max := 100.0, 10.0
+	if err := (ProjectQuery{MinFunding: &min, MaxFunding: &max}).Validate(); err == nil {
+		t.Error("Funding range should be rejected when min is greater than max")
+	}
+}
+
+func TestProjectQueryFilter(t *testing.T) {
+	filter := ProjectQuery{Tags: []string{"Arte", "Musica"}, AllTags: true}.filter()
+	tags := filter["tags"].(bson.M)["$all"].([]string)
+	if tags[0] != "arte" {
+		t.Error("Tags should be lowercased")
+	}
+
+	if len(ProjectQuery{}.filter()) != 0 {
+		t.Error("Empty query should match every project")
+	}
+}
+
+func TestDiffTags(t *testing.T) {
+	added, removed := diffTags([]string{"arte", "musica"}, []string{"musica", "cine", "cine"})
+
+	if len(added) != 1 || added[0] != "cine" {
+		t.Error("Only new tags should be added, once")
+	}
+
+	if len(removed) != 1 || removed[0] != "arte" {
+		t.Error("Only dropped tags should be removed")
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	if !CanTransition(StatusDraft, StatusActive) || !CanTransition(StatusActive, StatusFunded) {
+		t.Error("Campaigns should launch and close")
+	}
+
+	if CanTransition(StatusFunded, StatusActive) || CanTransition(StatusCancelled, StatusActive) {
+		t.Error("Closed campaigns can't be reopened")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	project := Project{Duration: 30, Goal: 1000, Funding: 250}
+	project.schedule(start)
+	project.computeFunding()
+
+	if !project.EndsAt.Equal(start.AddDate(0, 0, 30)) {
+		t.Error("Campaign should end after its duration")
+	}
+
+	if project.FundingPercentage != 25 {
+		t.Errorf("Funding percentage should be 25, got %v", project.FundingPercentage)
+	}
+}
+
+func TestClosingStatus(t *testing.T) {
+	if closingStatus(Project{Goal: 100, Funding: 100}) != StatusFunded {
+		t.Error("Campaigns that reach their goal should be funded")
+	}
+
+	if closingStatus(Project{Goal: 100, Funding: 99}) != StatusFailed {
+		t.Error("Campaigns below their goal should fail")
+	}
+
+	if closingStatus(Project{Goal: 0, Funding: 0}) != StatusFailed {
+		t.Error("Campaigns without a goal should not be funded")
+	}
+}
+
+func TestCheckPublishable(t *testing.T) {
+	err := Project{Title: "Huerto", Description: "Un huerto urbano"}.CheckPublishable()
+	missing, ok := err.(MissingFieldsError)
+	if !ok || len(missing.Fields) != 3 {
+		t.Errorf("Image, category and goal should be missing, got %v", err)
+	}
+
+	complete := Project{Title: "Huerto", Description: "Un huerto urbano", ImageURL: "image.png", Category: "ecologia", Goal: 500}
+	if err := complete.CheckPublishable(); err != nil {
+		t.Error("Complete project should be publishable")
+	}
+}
+
+func TestCanSee(t *testing.T) {
+	owner := primitive.NewObjectID()
+	draft := Project{Owner: owner, Status: StatusDraft}
+
+	if draft.CanSee("", false) || draft.CanSee(primitive.NewObjectID().Hex(), false) {
+		t.Error("Drafts should be hidden from other users")
+	}
+
+	if !draft.CanSee(owner.Hex(), false) || !draft.CanSee("", true) {
+		t.Error("Drafts should be visible to their owner and admins")
+	}
+}
+
+func TestEditRewardValidate(t *testing.T) {
+	if err := (EditReward{Title: "Playera", MinAmount: 200, Limit: 50}).Validate(); err != nil {
+		t.Error("Valid reward should pass")
+	}
+
+	if err := (EditReward{Title: "Playera"}).Validate(); err == nil {
+		t.Error("Reward without minimum should be rejected")
+	}
+
+	reward := newReward(EditReward{Title: "Playera", MinAmount: 200, Limit: 50})
+	if reward.Remaining == nil || *reward.Remaining != 50 || reward.Backers != 0 || reward.ID.IsZero() {
+		t.Error("New rewards should have all their quantity left")
+	}
+
+	if unlimited := newReward(EditReward{Title: "Gracias", MinAmount: 10}); unlimited.Remaining != nil {
+		t.Error("Unlimited rewards should have no remaining")
+	}
+
+	match, counters := reward.contribution(150)
+	if minimum, ok := match["min_amount"].(bson.M); !ok || minimum["$lte"] != float32(150) {
+		t.Errorf("Contribution should only match rewards whose minimum it reaches, got %v", match)
+	}
+	if _, ok := match["remaining"]; !ok || counters["rewards.$.remaining"] != -1 {
+		t.Error("Contributions to limited rewards should take one of the remaining")
+	}
+}
+
+func TestEditUpdateValidate(t *testing.T) {
+	update := EditUpdate{Title: "Avance", Body: "<p>Ya casi</p>"}
+	if err := update.Validate(); err != nil || update.Visibility != VisibilityPublic {
+		t.Error("Updates should be public by default")
+	}
+
+	if err := (&EditUpdate{Title: "Avance", Body: "Ya casi", Visibility: "friends"}).Validate(); err == nil {
+		t.Error("Unknown visibility should be rejected")
+	}
+
+	if body := bodyPolicy.Sanitize(`<p onclick="steal()">Hola<script>steal()</script></p>`); body != "<p>Hola</p>" {
+		t.Errorf("Scripts should be removed from the body, got %q", body)
+	}
+}
+
+func TestTeamRoles(t *testing.T) {
+	owner, editor, invited := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	project := Project{Owner: owner, Team: []TeamMember{
+		{User: editor, Role: RoleEditor, Status: MemberAccepted},
+		{User: invited, Role: RoleEditor, Status: MemberInvited},
+	}}
+
+	if !project.HasRole(owner.Hex(), RoleOwner) || !project.HasRole(owner.Hex(), RoleViewer) {
+		t.Error("Owner should have every role")
+	}
+
+	if !project.HasRole(editor.Hex(), RoleViewer) || project.HasRole(editor.Hex(), RoleOwner) {
+		t.Error("Editor should rank between viewer and owner")
+	}
+
+	if project.HasRole(invited.Hex(), RoleViewer) || len(project.PublicTeam()) != 1 {
+		t.Error("Pending invitations should not grant a role or be public")
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	backer := ContributionUser{ID: primitive.NewObjectID()}
+	project := Project{Goal: 100, Funding: 60, Contributions: []Contribution{{User: backer, Amount: 20}, {User: backer, Amount: 40}}}
+	analytics := project.Analytics()
+
+	if analytics.Backers != 1 || analytics.Contributions != 2 || analytics.AverageAmount != 30 {
+		t.Errorf("Backers should be counted once, got %+v", analytics)
+	}
+}
+
+func TestProposeTransferToSelf(t *testing.T) {
+	owner := primitive.NewObjectID().Hex()
+	err := (&ProjectStore{}).ProposeTransfer(context.Background(), primitive.NewObjectID().Hex(), owner, owner)
+	if err != ErrSelfTransfer {
+		t.Error("Owners can't transfer a project to themselves")
+	}
+}
+
+func TestParseProjectPatch(t *testing.T) {
+	patch, err := ParseProjectPatch([]byte(`{"subtitle":null,"tags":["Go"],"image_url":"a.png","version":3,"owner":"x"}`))
+	if err != nil {
+		t.Fatalf("ParseProjectPatch() error = %v", err)
+	}
+	if patch.Version == nil || *patch.Version != 3 {
+		t.Errorf("Version = %v, want 3", patch.Version)
+	}
+	if len(patch.Set) != 2 || patch.Set["image"] != "a.png" || patch.Set["tags"].([]string)[0] != "go" {
+		t.Errorf("Set = %v", patch.Set)
+	}
+	if !patch.Changes("subtitle") || patch.Changes("title") {
+		t.Errorf("Unset = %v, want [subtitle]", patch.Unset)
+	}
+
+	for _, body := range []string{`{"title":null}`, `{"title":" "}`, `{"goal":-1}`, `{"goal":0}`, `{"goal":null}`, `{"owner":"x"}`, `[]`} {
+		if _, err := ParseProjectPatch([]byte(body)); err == nil {
+			t.Errorf("ParseProjectPatch(%s) should fail", body)
+		}
+	}
+}
+
+func TestParseUserPatch(t *testing.T) {
+	patch, err := ParseUserPatch([]byte(`{"avatar_url":"b.png"}`))
+	if err != nil || patch.Set["avatar"] != "b.png" {
+		t.Errorf("ParseUserPatch() = %v, %v, want the avatar from avatar_url", patch.Set, err)
+	}
+
+	patch, err = ParseUserPatch([]byte(`{"avatar":"a.png"}`))
+	if err != nil || patch.Set["avatar"] != "a.png" {
+		t.Errorf("ParseUserPatch() = %v, %v, want avatar as an alias of avatar_url", patch.Set, err)
+	}
+
+	if _, err := ParseUserPatch([]byte(`{"avatar":"a.png","avatar_url":null}`)); err == nil {
+		t.Error("Setting both avatar and avatar_url should be rejected")
+	}
+}
+
+func TestRevisionHistory(t *testing.T) {
+	previous, _ := bson.Marshal(bson.M{"title": "Old", "duration": 30, "tags": bson.A{"go"}})
+	patch, err := ParseProjectPatch([]byte(`{"title":"New","duration":30,"tags":["Go"],"subtitle":"Sub"}`))
+	if err != nil {
+		t.Fatalf("ParseProjectPatch() error = %v", err)
+	}
+
+	changes := diffPatch(previous, patch, projectPatchFields)
+	if len(changes) != 2 || changes[0].Field != "subtitle" || changes[1].Field != "title" || changes[1].Before != "Old" {
+		t.Fatalf("diffPatch() = %+v, want subtitle and title changes", changes)
+	}
+
+	revisions := []Revision{
+		{Changes: []FieldChange{{"title", "A", "B"}}},
+		{Changes: []FieldChange{{"title", "B", "C"}, {"subtitle", nil, "S"}}},
+	}
+	values := valuesAt(revisions, 0)
+	if values["title"] != "B" || values["subtitle"] != nil {
+		t.Errorf("valuesAt(0) = %v, want title B and no subtitle", values)
+	}
+
+	values = valuesAt([]Revision{{Changes: []FieldChange{{"goal", nil, 5000.0}, {"subtitle", nil, "S"}}}}, -1)
+	keepRequired(values, projectPatchFields)
+	if _, ok := values["goal"]; ok || len(values) != 1 {
+		t.Errorf("keepRequired() = %v, want the current goal kept and subtitle cleared", values)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Huerto Urbano en Año Nuevo": "huerto-urbano-en-ano-nuevo",
+		"  ¡Canción para Niños!  ":   "cancion-para-ninos",
+		"Café & Pingüinos 2.0":       "cafe-pinguinos-2-0",
+		"¿¿??":                       "proyecto",
+		"5f8a3c2e9d1b4a0012345678":   "5f8a3c2e9d1b4a0012345678-p",
+	}
+	for title, want := range tests {
+		if got := Slugify(title); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", title, got, want)
+		}
+	}
+
+	stage := slugStage("nuevo")["$set"].(bson.M)
+	if stage["slug"].(bson.M)["$literal"] != "nuevo" {
+		t.Errorf("slugStage() slug = %v", stage["slug"])
+	}
+	if old := stage["old_slugs"].(bson.M)["$cond"].(bson.A); old[1] != "$$REMOVE" {
+		t.Errorf("slugStage() should leave out an empty old_slugs, got %v", old)
+	}
+
+	if unique := slugIndexes[1].Options.Unique; unique == nil || !*unique {
+		t.Error("Old slugs should be unique so they redirect to a single project")
+	}
+}
+
+func TestCategoryValidate(t *testing.T) {
+	valid := Category{Slug: "arte-y-cultura", Names: map[string]string{"es": "Arte y cultura", "en": "Art & culture"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	invalid := []Category{
+		{Slug: "Arte y Cultura", Names: valid.Names},
+		{Slug: "arte", Names: map[string]string{"en": "Art"}},
+		{Slug: "arte", Names: valid.Names, Parent: "arte"},
+	}
+	for _, category := range invalid {
+		if err := category.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", category)
+		}
+	}
+
+	valid.Localize("fr")
+	if valid.Name != "Arte y cultura" {
+		t.Errorf("Localize(fr) = %q, want the default language name", valid.Name)
+	}
+
+	if category := migratedCategory(" Arte y Cultura "); category.Validate() != nil || category.Slug != "arte-y-cultura" {
+		t.Errorf("migratedCategory() = %+v, want a valid category", category)
+	}
+	if err := migratedCategory("¿¿??").Validate(); err == nil {
+		t.Error("Categories without letters or digits should not be migrated")
+	}
+}
+
+func TestCategoryDescendants(t *testing.T) {
+	categories := []Category{
+		{Slug: "arte"},
+		{Slug: "musica", Parent: "arte"},
+		{Slug: "jazz", Parent: "musica"},
+		{Slug: "ciencia"},
+	}
+
+	got := descendants(categories, []string{"arte", "musica"})
+	if strings.Join(got, ",") != "arte,musica,jazz" {
+		t.Errorf("descendants() = %v, want arte and its subcategories once", got)
+	}
+}
+
+func TestTrendingPipeline(t *testing.T) {
+	now := time.Now()
+	pipeline := trendingPipeline(TrendingDay, trendingWindows[TrendingDay], now)
+
+	match := pipeline[0].(bson.M)["$match"].(bson.M)["at"].(bson.M)
+	if !match["$gt"].(time.Time).Equal(now.Add(-24 * time.Hour)) {
+		t.Errorf("window start = %v, want a day before now", match["$gt"])
+	}
+
+	merge := pipeline[2].(bson.M)["$merge"].(bson.M)
+	set := merge["whenMatched"].(bson.A)[0].(bson.M)["$set"].(bson.M)
+	if _, ok := set["trending.day"]; !ok || set["trending_refreshed.day"] != now {
+		t.Errorf("merge sets %v, want trending.day stamped with the refresh time", set)
+	}
+
+	if sort := searchSorts[SortTrending]; sort.Field != "trending.week" || sort.Direction != -1 {
+		t.Errorf("trending sort = %+v", sort)
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	ana, beto, owner := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	projects := []Project{
+		{ID: primitive.NewObjectID(), Owner: owner, Status: StatusActive, Category: "arte", Tags: []string{"musica"}, Votes: []primitive.ObjectID{ana, beto}},
+		{ID: primitive.NewObjectID(), Owner: owner, Status: StatusActive, Category: "arte", Votes: []primitive.ObjectID{beto}},
+		{ID: primitive.NewObjectID(), Owner: owner, Status: StatusActive, Category: "ciencia", Tags: []string{"musica"}},
+		{ID: primitive.NewObjectID(), Owner: ana, Status: StatusActive, Category: "arte"},
+		{ID: primitive.NewObjectID(), Owner: owner, Status: StatusFunded, Category: "arte"},
+	}
+
+	recommended := recommend(projects, 10)[ana]
+	if len(recommended) != 2 {
+		t.Fatalf("recommend() = %+v, want the two active projects ana didn't vote for or own", recommended)
+	}
+	if recommended[0].Project != projects[1].ID || recommended[1].Project != projects[2].ID {
+		t.Errorf("recommend() order = %+v, want the co-voted project first", recommended)
+	}
+}
+
+func TestGeoFilters(t *testing.T) {
+	if err := NewGeoPoint(-100.31, 25.67).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := NewGeoPoint(25.67, -100.31).Validate(); err == nil {
+		t.Error("Validate() should fail with swapped coordinates")
+	}
+
+	query := ProjectQuery{Sort: SortDistance}
+	if err := query.Validate(); err == nil {
+		t.Error("Validate() should fail sorting by distance without a point")
+	}
+
+	query.Near = &GeoNear{Lng: -100.31, Lat: 25.67, RadiusKm: 10}
+	query.Within = &GeoBox{SouthWest: [2]float64{-101, 25}, NorthEast: [2]float64{-100, 26}}
+	if err := query.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	box := query.filter()
+	within := box["geo"].(bson.M)["$geoWithin"].(bson.M)["$geometry"].(bson.M)
+	ring := within["coordinates"].(bson.A)[0].(bson.A)
+	if within["type"] != "Polygon" || len(ring) != 5 || ring[0].(bson.A)[0] != -101.0 || ring[2].(bson.A)[1] != 26.0 {
+		t.Errorf("filter() = %v, want the box as a polygon on geo", box)
+	}
+	if ring := (GeoBox{SouthWest: [2]float64{-110, 20}, NorthEast: [2]float64{-100, 30}}).ring(); len(ring) != 23 {
+		t.Errorf("ring() has %d vertices, want one per degree on the south and north edges", len(ring))
+	}
+	near := query.Near.stage(box)["$geoNear"].(bson.M)
+	if near["maxDistance"] != 10000.0 || near["query"] == nil {
+		t.Errorf("stage() = %v, want the radius in meters and the query", near)
+	}
+
+	swapped := GeoBox{SouthWest: [2]float64{-100, 26}, NorthEast: [2]float64{-101, 25}}
+	if err := swapped.Validate(); err == nil {
+		t.Error("Validate() should fail with swapped corners")
+	}
+}
+
+func TestEditCollectionValidate(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	collection := EditCollection{Title: "Ending soon in Education", Projects: []string{id}}
+	if err := collection.Validate(); err != nil || collection.Slug != "ending-soon-in-education" {
+		t.Errorf("Validate() slug = %q, error = %v", collection.Slug, err)
+	}
+
+	if err := (&EditCollection{Projects: []string{id}}).Validate(); err == nil {
+		t.Error("Collections without a title should be invalid")
+	}
+
+	if err := (&EditCollection{Title: "Staff picks", Slug: "Staff Picks"}).Validate(); err == nil {
+		t.Error("Slugs with spaces or capitals should be invalid")
+	}
+
+	if err := (&EditCollection{Title: "★★★"}).Validate(); err == nil {
+		t.Error("Titles without letters or digits need an explicit slug")
+	}
+	if err := (&EditCollection{Title: "★★★", Slug: "destacados"}).Validate(); err != nil {
+		t.Errorf("Validate() with an explicit slug error = %v", err)
+	}
+
+	starts := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	ends := starts.Add(-time.Hour)
+	if err := (&EditCollection{Title: "Staff picks", StartsAt: &starts, EndsAt: &ends}).Validate(); err == nil {
+		t.Error("Collections ending before they start should be invalid")
+	}
+
+	if err := (&EditCollection{Title: "Staff picks", Projects: []string{"nope"}}).Validate(); err == nil {
+		t.Error("Invalid project ids should be rejected")
+	}
+
+	if err := (&EditCollection{Title: "Staff picks", Projects: []string{id, id}}).Validate(); err == nil {
+		t.Error("Repeated projects should be rejected")
+	}
+}
+
+func TestPurgeReferences(t *testing.T) {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := NewProjectStore(client.Database("test"))
+
+	pulled := map[string]bool{}
+	for _, reference := range ps.references([]primitive.ObjectID{primitive.NewObjectID()}) {
+		pulled[reference.collection.Name()] = reference.update != nil
+	}
+
+	for _, collection := range []string{"updates", "project_revisions", "notifications", "project_activity"} {
+		if pulled, ok := pulled[collection]; !ok || pulled {
+			t.Errorf("The %s of purged projects should be deleted", collection)
+		}
+	}
+	for _, collection := range []string{"recommendations", "curated_collections"} {
+		if !pulled[collection] {
+			t.Errorf("Purged projects should be pulled from %s", collection)
+		}
+	}
+}
+
+func TestVoteUpdate(t *testing.T) {
+	uid := primitive.NewObjectID()
+
+	upvote := voteUpdate(uid, true)
+	votes := upvote[0].(bson.M)["$set"].(bson.M)["votes"].(bson.M)
+	if _, ok := votes["$setUnion"]; !ok {
+		t.Errorf("Upvotes should add the user once, got %v", votes)
+	}
+
+	unvote := voteUpdate(uid, false)
+	votes = unvote[0].(bson.M)["$set"].(bson.M)["votes"].(bson.M)
+	if _, ok := votes["$setDifference"]; !ok {
+		t.Errorf("Unvotes should remove the user, got %v", votes)
+	}
+
+	if _, ok := unvote[1].(bson.M)["$set"].(bson.M)["votes_count"]; !ok {
+		t.Error("votes_count should be recomputed in the same update")
+	}
+}
+
+func TestContributionFilter(t *testing.T) {
+	filter := contributionFilter(primitive.NewObjectID(), time.Now())
+
+	deleted := false
+	for _, condition := range filter["$and"].(bson.A) {
+		if _, ok := condition.(bson.M)["deleted_at"]; ok {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Errorf("Projects in the trash should not take contributions, got %v", filter)
+	}
+}
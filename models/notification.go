@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of notifications
+const (
+	NotifyCampaignFunded   = "campaign_funded"
+	NotifyCampaignFailed   = "campaign_failed"
+	NotifyProjectPublished = "project_published"
+	NotifyPublishFailed    = "publish_failed"
+	NotifyProjectUpdate    = "project_update"
+	NotifyTeamInvite       = "team_invite"
+	NotifyTransferProposed = "transfer_proposed"
+	NotifyTransferAccepted = "transfer_accepted"
+)
+
+// Notification is a message for a user about a project
+type Notification struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	Project   primitive.ObjectID `json:"project" bson:"project"`
+	Kind      string             `json:"kind" bson:"kind"`
+	Message   string             `json:"message" bson:"message"`
+	Read      bool               `json:"read" bson:"read"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// NotificationStore contains the operations on user notifications
+type NotificationStore struct {
+	collection *mongo.Collection
+}
+
+// NewNotificationStore creates a notification store with a mongo database
+func NewNotificationStore(database *mongo.Database) *NotificationStore {
+	return &NotificationStore{database.Collection("notifications")}
+}
+
+// CreateIndexes creates the indexes used to list notifications if they don't exist
+func (ns *NotificationStore) CreateIndexes(ctx context.Context) error {
+	_, err := ns.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+// Notify sends the same notification to every user, once each
+func (ns *NotificationStore) Notify(ctx context.Context, users []primitive.ObjectID, n Notification) error {
+	defer metrics.ObserveStore("notifications", "Notify", time.Now())
+
+	seen := make(map[primitive.ObjectID]bool, len(users))
+	documents := make([]interface{}, 0, len(users))
+	n.CreatedAt = time.Now()
+	for _, user := range users {
+		if user.IsZero() || seen[user] {
+			continue
+		}
+		seen[user] = true
+		n.User = user
+		documents = append(documents, n)
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+
+	_, err := ns.collection.InsertMany(ctx, documents)
+	return err
+}
+
+// GetByUser returns the latest notifications of a user
+func (ns *NotificationStore) GetByUser(ctx context.Context, userID string, limit int64) ([]Notification, error) {
+	defer metrics.ObserveStore("notifications", "GetByUser", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := ns.collection.Find(ctx, bson.M{"user": oid}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := make([]Notification, 0)
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// MarkRead marks all the notifications of a user as read
+func (ns *NotificationStore) MarkRead(ctx context.Context, userID string) error {
+	defer metrics.ObserveStore("notifications", "MarkRead", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = ns.collection.UpdateMany(ctx, bson.M{"user": oid, "read": false}, bson.M{"$set": bson.M{"read": true}})
+	return err
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DefaultPageLimit is the page size used when none is requested
+	DefaultPageLimit = 20
+	// MaxPageLimit is the largest page size a client can request
+	MaxPageLimit = 100
+)
+
+// Page describes which page of a listing to return
+type Page struct {
+	Limit  int64
+	Cursor string
+	Count  bool
+}
+
+// ProjectPage is a page of projects with the cursor to request the next one
+type ProjectPage struct {
+	Projects   []Project `json:"projects"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Total      *int64    `json:"total,omitempty"`
+}
+
+// pageSort is the order of a listing, ties are broken by _id in the same direction
+type pageSort struct {
+	Field     string
+	Direction int
+}
+
+var (
+	newestFirst = pageSort{"_id", -1}
+	byRelevance = pageSort{"score", -1}
+)
+
+// ErrInvalidCursor is returned when a page cursor can't be decoded
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+type pageCursor struct {
+	Field string             `bson:"f"`
+	Value bson.RawValue      `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+func (p Page) limit() int64 {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+func encodeCursor(field string, value bson.RawValue, id primitive.ObjectID) (string, error) {
+	if value.Type == 0 {
+		// The sort field is missing from the document
+		value = bson.RawValue{Type: bsontype.Null}
+	}
+	raw, err := bson.Marshal(pageCursor{field, value, id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(cursor string) (pageCursor, error) {
+	var pc pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pc, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(raw, &pc); err != nil {
+		return pc, ErrInvalidCursor
+	}
+	return pc, nil
+}
+
+// ValidCursor checks if a cursor was generated by a previous page
+func ValidCursor(cursor string) bool {
+	_, err := decodeCursor(cursor)
+	return err == nil
+}
+
+// after returns the filter matching the documents that come after the cursor in the given sort.
+// Missing and null values sort lowest, so they are handled apart from the comparison operators
+func (s pageSort) after(pc pageCursor) bson.M {
+	operator := "$gt"
+	if s.Direction < 0 {
+		operator = "$lt"
+	}
+
+	if s.Field == "_id" {
+		return bson.M{"_id": bson.M{operator: pc.ID}}
+	}
+
+	isNull := pc.Value.Type == 0 || pc.Value.Type == bsontype.Null
+	var value interface{} = pc.Value
+	if isNull {
+		value = nil
+	}
+
+	sameValue := bson.M{s.Field: value, "_id": bson.M{operator: pc.ID}}
+	switch {
+	case s.Direction < 0 && isNull:
+		return sameValue
+	case s.Direction < 0:
+		return bson.M{"$or": bson.A{bson.M{s.Field: bson.M{operator: value}}, sameValue, bson.M{s.Field: nil}}}
+	case isNull:
+		return bson.M{"$or": bson.A{bson.M{s.Field: bson.M{"$ne": nil}}, sameValue}}
+	default:
+		return bson.M{"$or": bson.A{bson.M{s.Field: bson.M{operator: value}}, sameValue}}
+	}
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrVersionConflict is returned when a document changed since the version the client edited
+var ErrVersionConflict = errors.New("The document was modified by someone else, reload it and try again")
+
+// Patch holds the changes of a partial update. Fields missing from the request are left
+// untouched, Set holds the new values and Unset the fields explicitly cleared with null.
+// Version is the version of the document the client edited, if it sent one
+type Patch struct {
+	Set     bson.M
+	Unset   []string
+	Version *int64
+}
+
+// patchField describes a field that can be patched: its document name, if it can be
+// cleared and how to decode and validate its value
+type patchField struct {
+	name     string
+	required bool
+	decode   func(raw json.RawMessage) (interface{}, error)
+}
+
+// parsePatch reads a JSON object or JSON Merge Patch (RFC 7386) body. Both behave the same
+// on flat documents: present fields are set and null fields are cleared. Unknown fields are ignored
+func parsePatch(body []byte, fields map[string]patchField) (Patch, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(body, &values); err != nil || values == nil {
+		return Patch{}, errors.New("The body must be a JSON object")
+	}
+
+	patch := Patch{Set: bson.M{}, Unset: make([]string, 0)}
+	if raw, ok := values["version"]; ok {
+		var version int64
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return Patch{}, errors.New("Invalid version")
+		}
+		patch.Version = &version
+	}
+
+	keys := make(map[string]string)
+	for key, raw := range values {
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if other, ok := keys[field.name]; ok {
+			return Patch{}, fmt.Errorf("%s and %s can't be used together", other, key)
+		}
+		keys[field.name] = key
+
+		if string(raw) == "null" {
+			if field.required {
+				return Patch{}, fmt.Errorf("%s can't be cleared", key)
+			}
+			patch.Unset = append(patch.Unset, field.name)
+			continue
+		}
+
+		value, err := field.decode(raw)
+		if err != nil {
+			return Patch{}, fmt.Errorf("Invalid %s: %s", key, err)
+		}
+		patch.Set[field.name] = value
+	}
+	sort.Strings(patch.Unset)
+
+	if len(patch.Set) == 0 && len(patch.Unset) == 0 {
+		return Patch{}, errors.New("Nothing to update")
+	}
+	return patch, nil
+}
+
+// Changes reports if a document field is set or cleared by the patch
+func (p Patch) Changes(name string) bool {
+	if _, ok := p.Set[name]; ok {
+		return true
+	}
+	for _, unset := range p.Unset {
+		if unset == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pipeline returns the update pipeline applying the patch and increasing the version,
+// followed by the extra stages. Values are wrapped in $literal so user text is never
+// read as an expression
+func (p Patch) pipeline(extra ...bson.M) bson.A {
+	set := bson.M{"version": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}}}
+	for name, value := range p.Set {
+		set[name] = bson.M{"$literal": value}
+	}
+
+	pipeline := bson.A{bson.M{"$set": set}}
+	if len(p.Unset) > 0 {
+		pipeline = append(pipeline, bson.M{"$unset": p.Unset})
+	}
+	for _, stage := range extra {
+		pipeline = append(pipeline, stage)
+	}
+	return pipeline
+}
+
+// versionFilter adds the expected version to filter, documents written before
+// versions existed are at version 0
+func versionFilter(filter bson.M, version *int64) bson.M {
+	if version == nil {
+		return filter
+	}
+	if *version == 0 {
+		return matchAll(filter, bson.M{"$or": bson.A{bson.M{"version": 0}, bson.M{"version": bson.M{"$exists": false}}}})
+	}
+	return matchAll(filter, bson.M{"version": *version})
+}
+
+func decodeString(raw json.RawMessage) (interface{}, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	return value, nil
+}
+
+func decodeRequiredString(raw json.RawMessage) (interface{}, error) {
+	value, err := decodeString(raw)
+	if err == nil && strings.TrimSpace(value.(string)) == "" {
+		return nil, errors.New("can't be empty")
+	}
+	return value, err
+}
+
+func decodeTags(raw json.RawMessage) (interface{}, error) {
+	var tags []string
+	if err := json.Unmarshal(raw, &tags); err != nil {
+		return nil, errors.New("must be a list of strings")
+	}
+	return lowerTags(tags), nil
+}
+
+func decodeDuration(raw json.RawMessage) (interface{}, error) {
+	var days int
+	if err := json.Unmarshal(raw, &days); err != nil || days < 0 {
+		return nil, errors.New("must be a positive number of days")
+	}
+	return days, nil
+}
+
+func decodeAmount(raw json.RawMessage) (interface{}, error) {
+	var amount float32
+	if err := json.Unmarshal(raw, &amount); err != nil || amount <= 0 {
+		return nil, errors.New("must be greater than zero")
+	}
+	return amount, nil
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jpr98/apis_pf_back/metrics"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -17,12 +18,14 @@ type Project struct {
 	ID            primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
 	Owner         primitive.ObjectID   `json:"owner,omitempty" bson:"owner,omitempty"`
 	Title         string               `json:"title,omitempty" bson:"title,omitempty"`
+	Slug          string               `json:"slug,omitempty" bson:"slug,omitempty"`
 	Subtitle      string               `json:"subtitle,omitempty" bson:"subtitle,omitempty"`
 	Description   string               `json:"description,omitempty" bson:"desc,omitempty"`
 	CreatedAt     time.Time            `json:"created_at,omitempty" bson:"created_at,omitempty"`
 	Tags          []string             `json:"tags,omitempty" bson:"tags,omitempty"`
 	Category      string               `json:"category,omitempty" bson:"category,omitempty"`
 	Location      string               `json:"location,omitempty" bson:"location,omitempty"`
+	Geo           *GeoPoint            `json:"geo,omitempty" bson:"geo,omitempty"`
 	Votes         []primitive.ObjectID `json:"votes,omitempty" bson:"votes,omitempty"`
 	VotesCount    int                  `json:"votes_count,omitempty" bson:"votes_count,omitempty"`
 	ImageURL      string               `json:"image_url,omitempty" bson:"image,omitempty"`
@@ -31,6 +34,26 @@ type Project struct {
 	Comments      []Comment            `json:"comments,omitempty" bson:"comments,omitempty"`
 	Contributions []Contribution       `json:"contributions,omitempty" bson:"contributions,omitempty"`
 	Duration      int                  `json:"duration,omitempty" bson:"duration,omitempty"`
+	Goal          float32              `json:"goal,omitempty" bson:"goal,omitempty"`
+	Funding       float32              `json:"funding" bson:"funding"`
+	Status        string               `json:"status,omitempty" bson:"status,omitempty"`
+	StartsAt      time.Time            `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	EndsAt        time.Time            `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	PublishAt     time.Time            `json:"publish_at,omitempty" bson:"publish_at,omitempty"`
+	DeletedAt     time.Time            `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Rewards       []Reward             `json:"rewards,omitempty" bson:"rewards,omitempty"`
+	Team          []TeamMember         `json:"team,omitempty" bson:"team,omitempty"`
+	Trending      map[string]float64   `json:"trending,omitempty" bson:"trending,omitempty"`
+
+	Transfer         *OwnershipTransfer `json:"-" bson:"transfer,omitempty"`
+	OwnershipHistory []OwnershipEvent   `json:"-" bson:"ownership_history,omitempty"`
+	OldSlugs         []string           `json:"-" bson:"old_slugs,omitempty"`
+
+	Version int64 `json:"version" bson:"version,omitempty"`
+
+	FundingPercentage float64 `json:"funding_percentage" bson:"-"`
+	// Distance is only set by searches near a point
+	Distance *float64 `json:"distance_km,omitempty" bson:"distance,omitempty"`
 }
 
 // ProjectStore contains all the CRUD operations of Project
@@ -44,25 +67,59 @@ func NewProjectStore(database *mongo.Database) *ProjectStore {
 	return &ProjectStore{database, database.Collection("projects")}
 }
 
+// CreateIndexes creates the indexes used by project queries if they don't exist
+func (ps *ProjectStore) CreateIndexes(ctx context.Context) error {
+	campaignIndex := mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "ends_at", Value: 1}}}
+	indexes := append([]mongo.IndexModel{textIndex, campaignIndex, geoIndex}, slugIndexes...)
+	_, err := ps.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
 // Create receives a project object and tries to insert it to the project store
-func (ps *ProjectStore) Create(p Project, ownerID string) (Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (ps *ProjectStore) Create(ctx context.Context, p Project, ownerID string) (Project, error) {
+	defer metrics.ObserveStore("projects", "Create", time.Now())
 
 	oid, err := primitive.ObjectIDFromHex(ownerID)
 	if err != nil {
 		return Project{}, err
 	}
 
-	for index, tag := range p.Tags {
-		p.Tags[index] = strings.ToLower(tag)
+	if err := ps.checkCategory(ctx, p.Category); err != nil {
+		return Project{}, err
 	}
 
+	p.Tags = lowerTags(p.Tags)
 	p.Owner = oid
 	p.Views = 0
 	p.VotesCount = 0
+	p.Funding = 0
+	p.Contributions = nil
 	p.CreatedAt = time.Now()
-	result, err := ps.collection.InsertOne(ctx, p)
+	// Projects start as drafts until their owner publishes them
+	p.Status = StatusDraft
+	p.StartsAt = time.Time{}
+	p.EndsAt = time.Time{}
+	p.PublishAt = time.Time{}
+	p.DeletedAt = time.Time{}
+	p.Team = nil
+	p.Trending = nil
+	p.Distance = nil
+	p.Version = 0
+	p.OldSlugs = nil
+	for index, reward := range p.Rewards {
+		p.Rewards[index] = newReward(reward.edit())
+	}
+
+	var result *mongo.InsertOneResult
+	for attempt := 1; ; attempt++ {
+		if p.Slug, err = ps.uniqueSlug(ctx, p.Title, primitive.NilObjectID); err != nil {
+			return Project{}, err
+		}
+		result, err = ps.collection.InsertOne(ctx, p)
+		if !isDuplicateKey(err) || attempt == slugAttempts {
+			break
+		}
+	}
 	if err != nil {
 		return Project{}, err
 	}
@@ -72,315 +129,295 @@ func (ps *ProjectStore) Create(p Project, ownerID string) (Project, error) {
 		return Project{}, errors.New("Invalid generated id on project")
 	}
 	p.ID = generatedID
+	p.computeFunding()
 
 	return p, nil
 }
 
-// EditProject helps to model de edit project data
-type EditProject struct {
-	Title       string   `json:"title,omitempty"`
-	Subtitle    string   `json:"subtitle,omitempty"`
-	Location    string   `json:"location,omitempty"`
-	Category    string   `json:"category,omitempty"`
-	Tags        []string `json:"tags,omitempty"`
-	ImageURL    string   `json:"image_url,omitempty"`
-	VideoURL    string   `json:"video_url,omitempty"`
-	Duration    int      `json:"duration,omitempty"`
-	Description string   `json:"description,omitempty"`
-}
-
-// Update edits a project's info
-func (ps *ProjectStore) Update(project Project, editProject EditProject) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	project.Title = editProject.Title
-	project.Subtitle = editProject.Subtitle
-	project.Location = editProject.Location
-	project.Category = editProject.Category
-	project.Tags = editProject.Tags
-	project.ImageURL = editProject.ImageURL
-	project.VideoURL = editProject.VideoURL
-	project.Duration = editProject.Duration
-	project.Description = editProject.Description
-
-	result, err := ps.collection.ReplaceOne(ctx, bson.M{"_id": project.ID}, project)
-	if err != nil {
-		return err
-	}
-
-	if result.MatchedCount == 0 {
-		return errors.New("No projects with given id")
-	}
+// projectPatchFields are the project fields its team can edit, by their JSON name
+var projectPatchFields = map[string]patchField{
+	"title":       {"title", true, decodeRequiredString},
+	"subtitle":    {"subtitle", false, decodeString},
+	"location":    {"location", false, decodeString},
+	"geo":         {"geo", false, decodeGeoPoint},
+	"category":    {"category", false, decodeString},
+	"tags":        {"tags", false, decodeTags},
+	"image_url":   {"image", false, decodeString},
+	"video_url":   {"video", false, decodeString},
+	"duration":    {"duration", false, decodeDuration},
+	"goal":        {"goal", true, decodeAmount},
+	"description": {"desc", false, decodeString},
+}
 
-	return nil
+// ParseProjectPatch reads the changes of a partial project update
+func ParseProjectPatch(body []byte) (Patch, error) {
+	return parsePatch(body, projectPatchFields)
 }
 
-// GetByID finds a project with a given id
-func (ps *ProjectStore) GetByID(id string) (Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Patch applies a partial update to a project and returns the updated project. Only the
+// fields in the patch are written, and if the patch has a version the update fails with
+// ErrVersionConflict when the project changed since then. The changes are recorded as a
+// revision by the author
+func (ps *ProjectStore) Patch(ctx context.Context, id, authorID string, patch Patch) (Project, error) {
+	defer metrics.ObserveStore("projects", "Patch", time.Now())
 
-	var project Project
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return Project{}, err
 	}
 
-	err = ps.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&project)
-	if err != nil {
-		return Project{}, err
+	if category, ok := patch.Set["category"].(string); ok {
+		if err := ps.checkCategory(ctx, category); err != nil {
+			return Project{}, err
+		}
 	}
 
-	ps.getCommentsAuthors(&project)
-	ps.getContributionsUsers(&project)
-
-	return project, nil
-}
-
-// GetByTitle returns all projects with titles containing the given query string
-func (ps *ProjectStore) GetByTitle(title string) ([]Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	filter := bson.D{{"title", primitive.Regex{Pattern: ".*" + title + ".*", Options: ""}}}
-	cursor, err := ps.collection.Find(ctx, filter)
-	if err != nil {
-		return nil, err
-	}
+	var stages []bson.M
+	if patch.Changes("duration") {
+		// Started campaigns keep their start date and end after the new duration
+		started := bson.M{"$ifNull": bson.A{"$starts_at", false}}
+		stages = append(stages, bson.M{"$set": bson.M{
+			"ends_at": bson.M{"$cond": bson.A{started, endsAtExpression("$starts_at"), "$ends_at"}},
+		}})
+	}
+	title, retitled := patch.Set["title"].(string)
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	filter := versionFilter(bson.M{"_id": oid}, patch.Version)
+	var raw bson.Raw
+	for attempt := 1; ; attempt++ {
+		update := stages
+		if retitled {
+			// A new title gets a new slug, links with the previous one redirect to it
+			slug, err := ps.uniqueSlug(ctx, title, oid)
+			if err != nil {
+				return Project{}, err
+			}
+			update = append(stages[:len(stages):len(stages)], slugStage(slug))
+		}
 
-	projects, err := ps.extractProjectsFromCursor(ctx, cursor)
-	if err != nil {
-		return nil, err
+		raw, err = ps.collection.FindOneAndUpdate(ctx, filter, patch.pipeline(update...), opts).DecodeBytes()
+		// A concurrent rename can take the slug first
+		if !retitled || !isDuplicateKey(err) || attempt == slugAttempts {
+			break
+		}
 	}
-
-	cursor.Close(ctx)
-	return projects, nil
-}
-
-// GetByTags returns all projects for a given set of tags
-func (ps *ProjectStore) GetByTags(tags []string) ([]Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cursor, err := ps.collection.Find(ctx, bson.D{{"tags", bson.D{{"$in", tags}}}})
-	if err != nil {
-		return nil, err
+	if err == mongo.ErrNoDocuments {
+		if err := ps.exists(ctx, oid); err != nil {
+			return Project{}, err
+		}
+		return Project{}, ErrVersionConflict
 	}
-
-	projects, err := ps.extractProjectsFromCursor(ctx, cursor)
 	if err != nil {
-		return nil, err
+		return Project{}, err
 	}
 
-	cursor.Close(ctx)
-	return projects, nil
-}
-
-// GetByCategory returns all projects for a given category
-func (ps *ProjectStore) GetByCategory(category string) ([]Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cursor, err := ps.collection.Find(ctx, bson.M{"category": category})
-	if err != nil {
-		return nil, err
+	var previous Project
+	if err := bson.Unmarshal(raw, &previous); err != nil {
+		return Project{}, err
 	}
+	ps.recordRevision(ctx, raw, previous.Version+1, authorID, patch)
 
-	projects, err := ps.extractProjectsFromCursor(ctx, cursor)
-	if err != nil {
-		return nil, err
+	if patch.Changes("tags") && previous.Status != StatusDraft {
+		tags, _ := patch.Set["tags"].([]string)
+		added, removed := diffTags(previous.Tags, tags)
+		ps.trackTags(ctx, added, removed)
 	}
 
-	cursor.Close(ctx)
-	return projects, nil
+	return ps.GetByID(ctx, id)
 }
 
-// GetFullSearch looks for projects by title, category and returns them in a specific order
-func (ps *ProjectStore) GetFullSearch(title, category, order string) ([]Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var query bson.M
-	if category != "todos" {
-		query = bson.M{"$and": bson.A{
-			bson.M{"title": primitive.Regex{Pattern: ".*" + title + ".*", Options: ""}},
-			bson.M{"category": category},
-		}}
-	} else {
-		query = bson.M{"$and": bson.A{
-			bson.M{"title": primitive.Regex{Pattern: ".*" + title + ".*", Options: ""}},
-		}}
-	}
-
-	options := &options.FindOptions{}
-	switch order {
-	case "popularity":
-		options.SetSort(bson.M{"votes_count": -1})
-	case "date":
-		options.SetSort(bson.M{"created_at": 1})
-	default:
-		options = nil
-	}
+// GetByID finds a project with a given id
+func (ps *ProjectStore) GetByID(ctx context.Context, id string) (Project, error) {
+	defer metrics.ObserveStore("projects", "GetByID", time.Now())
 
-	cursor, err := ps.collection.Find(ctx, query, options)
+	var project Project
+	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return Project{}, err
 	}
 
-	projects, err := ps.extractProjectsFromCursor(ctx, cursor)
+	err = ps.collection.FindOne(ctx, matchAll(bson.M{"_id": oid}, notDeleted)).Decode(&project)
 	if err != nil {
-		return nil, err
+		return Project{}, err
 	}
 
-	cursor.Close(ctx)
-	return projects, nil
+	ps.hydrate(ctx, &project)
+
+	return project, nil
 }
 
-// GetByOwnerID returns projects with a given owner ID
-func (ps *ProjectStore) GetByOwnerID(ownerID string) ([]Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// GetByOwnerID returns a page of projects with a given owner ID, including drafts if requested
+func (ps *ProjectStore) GetByOwnerID(ctx context.Context, ownerID string, drafts bool, page Page) (ProjectPage, error) {
+	defer metrics.ObserveStore("projects", "GetByOwnerID", time.Now())
 
 	oid, err := primitive.ObjectIDFromHex(ownerID)
 	if err != nil {
-		return nil, err
+		return ProjectPage{}, err
 	}
 
-	cursor, err := ps.collection.Find(ctx, bson.M{"owner": oid})
-	if err != nil {
-		return nil, err
+	filter := matchAll(bson.M{"owner": oid}, notDeleted)
+	if !drafts {
+		filter = matchAll(filter, published)
 	}
+	return ps.findPage(ctx, filter, newestFirst, page)
+}
+
+// GetVotedProjects returns a page of the projects that a user has voted for
+func (ps *ProjectStore) GetVotedProjects(ctx context.Context, userID string, page Page) (ProjectPage, error) {
+	defer metrics.ObserveStore("projects", "GetVotedProjects", time.Now())
 
-	projects, err := ps.extractProjectsFromCursor(ctx, cursor)
+	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, err
+		return ProjectPage{}, err
 	}
 
-	cursor.Close(ctx)
-	return projects, nil
+	query := matchAll(bson.M{"votes": bson.M{"$in": []primitive.ObjectID{uid}}}, published)
+	return ps.findPage(ctx, query, newestFirst, page)
 }
 
-// GetVotedProjects returns the projects that a user has voted for
-func (ps *ProjectStore) GetVotedProjects(userID string) ([]Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// GetContributedProjects returns a page of the projects that a user has contributed to
+func (ps *ProjectStore) GetContributedProjects(ctx context.Context, userID string, page Page) (ProjectPage, error) {
+	defer metrics.ObserveStore("projects", "GetContributedProjects", time.Now())
 
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, err
+		return ProjectPage{}, err
 	}
 
-	query := bson.D{{"votes", bson.D{{"$in", []primitive.ObjectID{uid}}}}}
-	cursor, err := ps.collection.Find(ctx, query)
-	if err != nil {
-		return nil, err
-	}
+	query := matchAll(bson.M{"contributions.user._id": uid}, published)
+	return ps.findPage(ctx, query, newestFirst, page)
+}
 
-	projects, err := ps.extractProjectsFromCursor(ctx, cursor)
+// Vote appends or removes a user to the list of votes of a project
+func (ps *ProjectStore) Vote(ctx context.Context, projectID string, userID string, upvote bool) error {
+	defer metrics.ObserveStore("projects", "Vote", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(projectID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	cursor.Close(ctx)
-	return projects, nil
-}
-
-// GetContributedProjects returns the projects that a user has contributed to
-func (ps *ProjectStore) GetContributedProjects(userID string) ([]Project, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	query := bson.M{"contributions.user._id": uid}
-	cursor, err := ps.collection.Find(ctx, query)
+	result, err := ps.collection.UpdateOne(ctx, matchAll(bson.M{"_id": pid}, published), voteUpdate(uid, upvote))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	projects, err := ps.extractProjectsFromCursor(ctx, cursor)
-	if err != nil {
-		return nil, err
+	if result.MatchedCount == 0 {
+		return errors.New("No project found with given id")
 	}
 
-	cursor.Close(ctx)
-	return projects, nil
+	if upvote && result.ModifiedCount > 0 {
+		ps.trackActivity(ctx, pid, ActivityVote)
+	}
+	return nil
 }
 
-// Vote appends or removes a user to the list of votes of a project
-func (ps *ProjectStore) Vote(projectID string, userID string, upvote bool) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// RebuildTagUsage recomputes the tag usage counts from every published project
+func (ps *ProjectStore) RebuildTagUsage(ctx context.Context) error {
+	defer metrics.ObserveStore("projects", "RebuildTagUsage", time.Now())
 
-	pid, err := primitive.ObjectIDFromHex(projectID)
-	if err != nil {
-		return err
+	pipeline := bson.A{
+		bson.M{"$match": published},
+		bson.M{"$unwind": "$tags"},
+		bson.M{"$group": bson.M{"_id": bson.M{"project": "$_id", "tag": "$tags"}}},
+		bson.M{"$group": bson.M{"_id": "$_id.tag", "count": bson.M{"$sum": 1}}},
+		bson.M{"$out": tagsCollection},
 	}
-
-	uid, err := primitive.ObjectIDFromHex(userID)
+	cursor, err := ps.collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return err
 	}
+	return cursor.Close(ctx)
+}
 
-	var updateAction string
-	var incAmount int
-	if upvote {
-		updateAction = "$addToSet"
-		incAmount = 1
-	} else {
-		updateAction = "$pull"
-		incAmount = -1
-	}
-	update := bson.M{updateAction: bson.M{"votes": uid}}
-	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": pid}, update)
+// VotesDiscrepancy describes a project whose votes_count didn't match its votes
+type VotesDiscrepancy struct {
+	ProjectID primitive.ObjectID `json:"project_id"`
+	Title     string             `json:"title"`
+	Stored    int                `json:"stored"`
+	Actual    int                `json:"actual"`
+}
+
+// RepairVotesCount recomputes votes_count from votes for every project and
+// returns the projects that were out of sync
+func (ps *ProjectStore) RepairVotesCount(ctx context.Context) ([]VotesDiscrepancy, error) {
+	defer metrics.ObserveStore("projects", "RepairVotesCount", time.Now())
+
+	projection := options.Find().SetProjection(bson.M{"title": 1, "votes": 1, "votes_count": 1})
+	cursor, err := ps.collection.Find(ctx, bson.M{}, projection)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	if result.MatchedCount == 0 {
-		return errors.New("No project found with given id")
+	discrepancies := make([]VotesDiscrepancy, 0)
+	for cursor.Next(ctx) {
+		var project Project
+		if err := cursor.Decode(&project); err != nil {
+			return nil, err
+		}
+		if project.VotesCount != len(project.Votes) {
+			discrepancies = append(discrepancies, VotesDiscrepancy{project.ID, project.Title, project.VotesCount, len(project.Votes)})
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
 	}
 
-	if result.ModifiedCount > 0 {
-		_, err := ps.collection.UpdateOne(ctx, bson.M{"_id": pid}, bson.M{"$inc": bson.M{"votes_count": incAmount}})
-		if err != nil {
-			return err
+	for _, discrepancy := range discrepancies {
+		update := bson.A{votesCountStage()}
+		if _, err := ps.collection.UpdateOne(ctx, bson.M{"_id": discrepancy.ProjectID}, update); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	return discrepancies, nil
 }
 
-// Delete removes a project with a given id
-func (ps *ProjectStore) Delete(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Delete moves a project to the trash, where it is hidden and can be restored until it is
+// purged. Projects with contributions are kept for their backers and can't be deleted
+func (ps *ProjectStore) Delete(ctx context.Context, id string) (time.Time, error) {
+	defer metrics.ObserveStore("projects", "Delete", time.Now())
 
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
 
-	result, err := ps.collection.DeleteOne(ctx, bson.M{"_id": oid})
+	now := time.Now()
+	var deleted Project
+	filter := matchAll(bson.M{"_id": oid, "contributions.0": bson.M{"$exists": false}}, notDeleted)
+	updateOptions := options.FindOneAndUpdate().SetProjection(bson.M{"tags": 1, "status": 1})
+	err = ps.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"deleted_at": now}}, updateOptions).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
+		count, err := ps.collection.CountDocuments(ctx, matchAll(bson.M{"_id": oid}, notDeleted))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if count > 0 {
+			return time.Time{}, ErrHasContributions
+		}
+		return time.Time{}, errors.New("No projects with id found")
+	}
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
 
-	if result.DeletedCount == 0 {
-		return errors.New("No projects with id found")
+	if deleted.Status != StatusDraft {
+		ps.trackTags(ctx, nil, deleted.Tags)
 	}
-
-	return nil
+	return now, nil
 }
 
 // View increments the views of a project by one
-func (ps *ProjectStore) View(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (ps *ProjectStore) View(ctx context.Context, id string) error {
+	defer metrics.ObserveStore("projects", "View", time.Now())
 
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -388,7 +425,7 @@ func (ps *ProjectStore) View(id string) error {
 	}
 
 	update := bson.M{"$inc": bson.M{"views": 1}}
-	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	result, err := ps.collection.UpdateOne(ctx, matchAll(bson.M{"_id": oid}, published), update)
 	if err != nil {
 		return err
 	}
@@ -397,13 +434,13 @@ func (ps *ProjectStore) View(id string) error {
 		return errors.New("No projects with id found")
 	}
 
+	ps.trackActivity(ctx, oid, ActivityView)
 	return nil
 }
 
 // AddComment appends a comment to a project
-func (ps *ProjectStore) AddComment(id, authorID, text string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (ps *ProjectStore) AddComment(ctx context.Context, id, authorID, text string) error {
+	defer metrics.ObserveStore("projects", "AddComment", time.Now())
 
 	pid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -419,7 +456,7 @@ func (ps *ProjectStore) AddComment(id, authorID, text string) error {
 	comment := Comment{primitive.NewObjectID(), author, time.Now(), text}
 
 	update := bson.M{"$push": bson.M{"comments": comment}}
-	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": pid}, update)
+	result, err := ps.collection.UpdateOne(ctx, matchAll(bson.M{"_id": pid}, published), update)
 	if err != nil {
 		return err
 	}
@@ -428,13 +465,18 @@ func (ps *ProjectStore) AddComment(id, authorID, text string) error {
 		return errors.New("No project found with given id")
 	}
 
+	ps.trackActivity(ctx, pid, ActivityComment)
 	return nil
 }
 
-// AddContribution appends a contribution to a project
-func (ps *ProjectStore) AddContribution(id, userID string, amount float32) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// AddContribution appends a contribution to a project while its campaign is active,
+// claiming one of the chosen reward when rewardID is set
+func (ps *ProjectStore) AddContribution(ctx context.Context, id, userID string, amount float32, rewardID string) error {
+	defer metrics.ObserveStore("projects", "AddContribution", time.Now())
+
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
 
 	pid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -446,41 +488,237 @@ func (ps *ProjectStore) AddContribution(id, userID string, amount float32) error
 		return err
 	}
 
+	now := time.Now()
 	user := ContributionUser{ID: uid}
-	contribution := Contribution{primitive.NewObjectID(), user, amount, time.Now()}
+	contribution := Contribution{ID: primitive.NewObjectID(), User: user, Amount: amount, Date: now}
 
-	update := bson.M{"$push": bson.M{"contributions": contribution}}
-	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": pid}, update)
+	filter := contributionFilter(pid, now)
+	counters := bson.M{"funding": amount}
+	if rewardID != "" {
+		rewardFilter, rewardCounters, err := ps.rewardContribution(ctx, pid, rewardID, amount)
+		if err != nil {
+			return err
+		}
+		contribution.Reward, _ = primitive.ObjectIDFromHex(rewardID)
+		filter = matchAll(filter, rewardFilter)
+		for field, value := range rewardCounters {
+			counters[field] = value
+		}
+	}
+
+	update := bson.M{
+		"$push": bson.M{"contributions": contribution},
+		"$inc":  counters,
+	}
+	result, err := ps.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
 
 	if result.MatchedCount == 0 {
-		return errors.New("No project found with given id")
+		if err := ps.exists(ctx, pid); err != nil {
+			return err
+		}
+		if rewardID != "" {
+			count, err := ps.collection.CountDocuments(ctx, contributionFilter(pid, now))
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ps.rewardRejection(ctx, pid, rewardID, amount)
+			}
+		}
+		return ErrCampaignNotActive
 	}
 
+	ps.trackActivity(ctx, pid, ActivityContribution)
 	return nil
 }
 
-func (ps *ProjectStore) extractProjectsFromCursor(ctx context.Context, cursor *mongo.Cursor) ([]Project, error) {
-	projects := make([]Project, 0)
+// contributionFilter matches a project that can take contributions at now: not in the
+// trash and with its campaign active
+func contributionFilter(pid primitive.ObjectID, now time.Time) bson.M {
+	return matchAll(bson.M{"_id": pid}, activeWindow(now), notDeleted)
+}
+
+// Audience returns the users that voted for and contributed to a project
+func (ps *ProjectStore) Audience(ctx context.Context, id string) (voters, backers []primitive.ObjectID, err error) {
+	defer metrics.ObserveStore("projects", "Audience", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var project Project
+	findOptions := options.FindOne().SetProjection(bson.M{"votes": 1, "contributions.user._id": 1})
+	if err := ps.collection.FindOne(ctx, bson.M{"_id": oid}, findOptions).Decode(&project); err != nil {
+		return nil, nil, err
+	}
+
+	for _, contribution := range project.Contributions {
+		backers = append(backers, contribution.User.ID)
+	}
+	return project.Votes, backers, nil
+}
+
+// IsBacker checks if a user contributed to a project
+func (ps *ProjectStore) IsBacker(ctx context.Context, id, userID string) (bool, error) {
+	defer metrics.ObserveStore("projects", "IsBacker", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, nil
+	}
+
+	count, err := ps.collection.CountDocuments(ctx, bson.M{"_id": pid, "contributions.user._id": uid})
+	return count > 0, err
+}
+
+// voteUpdate adds or removes a user from the votes of a project. A single pipeline update
+// keeps votes and votes_count in sync atomically
+func voteUpdate(uid primitive.ObjectID, upvote bool) bson.A {
+	votes := bson.M{"$ifNull": bson.A{"$votes", bson.A{}}}
+	updatedVotes := bson.M{"$setDifference": bson.A{votes, bson.A{uid}}}
+	if upvote {
+		updatedVotes = bson.M{"$setUnion": bson.A{votes, bson.A{uid}}}
+	}
+
+	return bson.A{
+		bson.M{"$set": bson.M{"votes": updatedVotes}},
+		votesCountStage(),
+	}
+}
+
+func votesCountStage() bson.M {
+	return bson.M{"$set": bson.M{"votes_count": bson.M{"$size": bson.M{"$ifNull": bson.A{"$votes", bson.A{}}}}}}
+}
+
+// findPage returns the page of projects matching filter in the given order
+func (ps *ProjectStore) findPage(ctx context.Context, filter bson.M, sort pageSort, page Page) (ProjectPage, error) {
+	return ps.aggregatePage(ctx, bson.A{bson.M{"$match": filter}}, sort, page)
+}
+
+// rankedPage returns the page of projects matching filter in the order of ids
+func (ps *ProjectStore) rankedPage(ctx context.Context, ids []primitive.ObjectID, filter bson.M, page Page) (ProjectPage, error) {
+	pipeline := bson.A{
+		bson.M{"$match": matchAll(bson.M{"_id": bson.M{"$in": ids}}, filter)},
+		bson.M{"$addFields": bson.M{"rank": bson.M{"$indexOfArray": bson.A{ids, "$_id"}}}},
+	}
+	return ps.aggregatePage(ctx, pipeline, pageSort{"rank", 1}, page)
+}
+
+// aggregatePage returns the page of projects produced by pipeline in the given order
+func (ps *ProjectStore) aggregatePage(ctx context.Context, pipeline bson.A, sort pageSort, page Page) (ProjectPage, error) {
+	result := ProjectPage{Projects: make([]Project, 0)}
+	if page.Count {
+		total, err := ps.count(ctx, pipeline)
+		if err != nil {
+			return ProjectPage{}, err
+		}
+		result.Total = &total
+	}
+
+	pipeline = append(bson.A{}, pipeline...)
+	if sort == byRelevance {
+		pipeline = append(pipeline, bson.M{"$addFields": bson.M{"score": bson.M{"$meta": "textScore"}}})
+	}
+
+	if page.Cursor != "" {
+		pc, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return ProjectPage{}, err
+		}
+		if pc.Field != sort.Field {
+			return ProjectPage{}, ErrInvalidCursor
+		}
+		pipeline = append(pipeline, bson.M{"$match": sort.after(pc)})
+	}
+
+	order := bson.D{{Key: "_id", Value: sort.Direction}}
+	if sort.Field != "_id" {
+		order = append(bson.D{{Key: sort.Field, Value: sort.Direction}}, order...)
+	}
+
+	// One extra project is requested to know if there is a next page
+	limit := page.limit()
+	pipeline = append(pipeline, bson.M{"$sort": order}, bson.M{"$limit": limit + 1})
+	cursor, err := ps.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return ProjectPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var last bson.RawValue
 	for cursor.Next(ctx) {
+		if int64(len(result.Projects)) == limit {
+			next, err := encodeCursor(sort.Field, last, result.Projects[limit-1].ID)
+			if err != nil {
+				return ProjectPage{}, err
+			}
+			result.NextCursor = next
+			break
+		}
+
 		var project Project
-		err := cursor.Decode(&project)
-		if err != nil {
-			return nil, err
+		if err := cursor.Decode(&project); err != nil {
+			return ProjectPage{}, err
+		}
+		last = cursor.Current.Lookup(strings.Split(sort.Field, ".")...)
+		last.Value = append([]byte(nil), last.Value...)
+
+		ps.hydrate(ctx, &project)
+		result.Projects = append(result.Projects, project)
+	}
+	if err := cursor.Err(); err != nil {
+		return ProjectPage{}, err
+	}
+
+	return result, nil
+}
+
+// trackTags updates the tag usage counts, which only count published projects. Failures are not reported to the caller because
+// the project write already succeeded, the counts can be rebuilt with RebuildTagUsage
+func (ps *ProjectStore) trackTags(ctx context.Context, added, removed []string) {
+	_ = NewTagStore(ps.database).Track(ctx, added, removed)
+}
+
+// count returns the number of projects produced by pipeline
+func (ps *ProjectStore) count(ctx context.Context, pipeline bson.A) (int64, error) {
+	cursor, err := ps.collection.Aggregate(ctx, append(append(bson.A{}, pipeline...), bson.M{"$count": "total"}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total int64 `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
 		}
-		ps.getCommentsAuthors(&project)
-		ps.getContributionsUsers(&project)
-		projects = append(projects, project)
 	}
-	return projects, nil
+	return result.Total, cursor.Err()
+}
+
+// hydrate fills the fields of a project that are not stored with it
+func (ps *ProjectStore) hydrate(ctx context.Context, project *Project) {
+	ps.getCommentsAuthors(ctx, project)
+	ps.getContributionsUsers(ctx, project)
+	ps.getTeamMembers(ctx, project)
+	project.computeFunding()
 }
 
-func (ps *ProjectStore) getCommentsAuthors(project *Project) {
+func (ps *ProjectStore) getCommentsAuthors(ctx context.Context, project *Project) {
 	for index, comment := range project.Comments {
 		userStore := NewUserStore(ps.database)
-		user, err := userStore.GetByID(comment.Author.ID.Hex())
+		user, err := userStore.GetByID(ctx, comment.Author.ID.Hex())
 		if err != nil {
 			project.Comments[index].Author = CommentAuthor{user.ID, "Eliminado", ""}
 		}
@@ -488,10 +726,10 @@ func (ps *ProjectStore) getCommentsAuthors(project *Project) {
 	}
 }
 
-func (ps *ProjectStore) getContributionsUsers(project *Project) {
+func (ps *ProjectStore) getContributionsUsers(ctx context.Context, project *Project) {
 	for index, comment := range project.Contributions {
 		userStore := NewUserStore(ps.database)
-		user, err := userStore.GetByID(comment.User.ID.Hex())
+		user, err := userStore.GetByID(ctx, comment.User.ID.Hex())
 		if err != nil {
 			project.Contributions[index].User = ContributionUser{user.ID, "Eliminado", ""}
 		}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// published matches the projects visible to everyone, drafts are only visible to their owner and admins
+// and deleted projects to no one
+var published = bson.M{"status": bson.M{"$ne": StatusDraft}, "deleted_at": bson.M{"$exists": false}}
+
+// ErrNotDraft is returned when scheduling the publication of a project that was already published
+var ErrNotDraft = errors.New("Only drafts can be scheduled")
+
+// MissingFieldsError is returned when publishing a project without all its required fields
+type MissingFieldsError struct {
+	Fields []string
+}
+
+func (e MissingFieldsError) Error() string {
+	return "Missing required fields to publish: " + strings.Join(e.Fields, ", ")
+}
+
+// CheckPublishable returns a MissingFieldsError if the project lacks a field required to publish it
+func (p Project) CheckPublishable() error {
+	missing := make([]string, 0)
+	if strings.TrimSpace(p.Title) == "" {
+		missing = append(missing, "title")
+	}
+	if strings.TrimSpace(p.Description) == "" {
+		missing = append(missing, "description")
+	}
+	if p.ImageURL == "" {
+		missing = append(missing, "image_url")
+	}
+	if p.Category == "" {
+		missing = append(missing, "category")
+	}
+	if p.Goal <= 0 {
+		missing = append(missing, "goal")
+	}
+
+	if len(missing) > 0 {
+		return MissingFieldsError{missing}
+	}
+	return nil
+}
+
+// Publish launches a draft at the given time, right away when at is not in the future
+func (ps *ProjectStore) Publish(ctx context.Context, id string, at time.Time) error {
+	defer metrics.ObserveStore("projects", "Publish", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	var project Project
+	if err := ps.collection.FindOne(ctx, matchAll(bson.M{"_id": oid}, notDeleted)).Decode(&project); err != nil {
+		return err
+	}
+	if project.Status != StatusDraft {
+		return ErrInvalidTransition
+	}
+	if err := project.CheckPublishable(); err != nil {
+		return err
+	}
+
+	if !at.After(time.Now()) {
+		return ps.Transition(ctx, id, StatusActive)
+	}
+
+	return ps.setPublishAt(ctx, oid, bson.M{"$set": bson.M{"publish_at": at}})
+}
+
+// Unschedule cancels the scheduled publication of a draft
+func (ps *ProjectStore) Unschedule(ctx context.Context, id string) error {
+	defer metrics.ObserveStore("projects", "Unschedule", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	return ps.setPublishAt(ctx, oid, bson.M{"$unset": bson.M{"publish_at": ""}})
+}
+
+func (ps *ProjectStore) setPublishAt(ctx context.Context, oid primitive.ObjectID, update bson.M) error {
+	result, err := ps.collection.UpdateOne(ctx, matchAll(bson.M{"_id": oid, "status": StatusDraft}, notDeleted), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if err := ps.exists(ctx, oid); err != nil {
+			return err
+		}
+		return ErrNotDraft
+	}
+	return nil
+}
+
+// ScheduledPublication is the result of publishing a draft scheduled by its owner
+type ScheduledPublication struct {
+	ID    primitive.ObjectID
+	Title string
+	Owner primitive.ObjectID
+	Err   error
+}
+
+// PublishScheduled publishes the drafts scheduled before now. Drafts that lost a required
+// field since they were scheduled are unscheduled and returned with the error
+func (ps *ProjectStore) PublishScheduled(ctx context.Context, now time.Time) ([]ScheduledPublication, error) {
+	defer metrics.ObserveStore("projects", "PublishScheduled", time.Now())
+
+	cursor, err := ps.collection.Find(ctx, matchAll(bson.M{"status": StatusDraft, "publish_at": bson.M{"$lte": now}}, notDeleted))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	publications := make([]ScheduledPublication, 0)
+	for cursor.Next(ctx) {
+		var project Project
+		if err := cursor.Decode(&project); err != nil {
+			return publications, err
+		}
+
+		publication := ScheduledPublication{ID: project.ID, Title: project.Title, Owner: project.Owner}
+		if publication.Err = project.CheckPublishable(); publication.Err != nil {
+			err = ps.setPublishAt(ctx, project.ID, bson.M{"$unset": bson.M{"publish_at": ""}})
+		} else {
+			err = ps.Transition(ctx, project.ID.Hex(), StatusActive)
+		}
+		if err == ErrNotDraft || err == ErrInvalidTransition {
+			// Published or unscheduled concurrently
+			continue
+		}
+		if err != nil {
+			return publications, err
+		}
+		publications = append(publications, publication)
+	}
+
+	return publications, cursor.Err()
+}
+
+// CanSee checks if a user can see a project, drafts are only visible to their team and admins
+func (p Project) CanSee(userID string, admin bool) bool {
+	return p.Status != StatusDraft || admin || p.RoleOf(userID) != ""
+}
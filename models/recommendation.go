@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxRecommendations is the number of projects cached for each user
+const maxRecommendations = 50
+
+// Weights of each signal in the recommendation score
+const (
+	tagAffinityWeight      = 1
+	categoryAffinityWeight = 2
+	coVotingWeight         = 3
+)
+
+// Recommendation is a project recommended to a user with its score
+type Recommendation struct {
+	Project primitive.ObjectID `bson:"project"`
+	Score   float64            `bson:"score"`
+}
+
+// recommendations is the cached list of recommendations of a user
+type recommendations struct {
+	User       primitive.ObjectID `bson:"_id"`
+	Projects   []Recommendation   `bson:"projects"`
+	ComputedAt time.Time          `bson:"computed_at"`
+}
+
+// RecommendationStore contains the cached project recommendations of the users
+type RecommendationStore struct {
+	database   *mongo.Database
+	collection *mongo.Collection
+}
+
+// NewRecommendationStore creates a recommendation store with a mongo database
+func NewRecommendationStore(database *mongo.Database) *RecommendationStore {
+	return &RecommendationStore{database, database.Collection("recommendations")}
+}
+
+// GetProjects returns a page of the projects recommended to a user, best first. Projects the
+// user interacted with since the recommendations were computed are left out
+func (rs *RecommendationStore) GetProjects(ctx context.Context, userID string, page Page) (ProjectPage, error) {
+	defer metrics.ObserveStore("recommendations", "GetProjects", time.Now())
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ProjectPage{}, err
+	}
+
+	var cached recommendations
+	err = rs.collection.FindOne(ctx, bson.M{"_id": uid}).Decode(&cached)
+	if err == mongo.ErrNoDocuments {
+		return ProjectPage{Projects: make([]Project, 0)}, nil
+	}
+	if err != nil {
+		return ProjectPage{}, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(cached.Projects))
+	for _, recommendation := range cached.Projects {
+		ids = append(ids, recommendation.Project)
+	}
+
+	filter := matchAll(bson.M{"votes": bson.M{"$ne": uid}, "contributions.user._id": bson.M{"$ne": uid}}, published)
+	return NewProjectStore(rs.database).rankedPage(ctx, ids, filter, page)
+}
+
+// Refresh recomputes the recommendations of every user that voted for or contributed to a
+// project and returns how many users got recommendations
+func (rs *RecommendationStore) Refresh(ctx context.Context, now time.Time) (int, error) {
+	defer metrics.ObserveStore("recommendations", "Refresh", time.Now())
+
+	// Dates are stored in milliseconds, truncating keeps the recommendations written in this
+	// run equal to now so the stale ones are the only ones before it
+	now = now.Truncate(time.Millisecond)
+
+	projection := bson.M{"owner": 1, "status": 1, "category": 1, "tags": 1, "votes": 1, "contributions.user._id": 1}
+	cursor, err := NewProjectStore(rs.database).collection.Find(ctx, published, options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, err
+	}
+
+	var projects []Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return 0, err
+	}
+
+	computed := recommend(projects, maxRecommendations)
+	writes := make([]mongo.WriteModel, 0, len(computed))
+	for user, projects := range computed {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": user}).
+			SetReplacement(recommendations{user, projects, now}).
+			SetUpsert(true))
+	}
+	if len(writes) > 0 {
+		if _, err := rs.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return 0, err
+		}
+	}
+
+	// Users without interactions anymore keep no stale recommendations
+	if _, err := rs.collection.DeleteMany(ctx, bson.M{"computed_at": bson.M{"$lt": now}}); err != nil {
+		return len(computed), err
+	}
+	return len(computed), nil
+}
+
+// recommend ranks the active projects for each user that interacted with a project. The score
+// adds the user's affinity for the project tags and category to how similar the users that
+// interacted with it are to the user, measured by the cosine of their interactions. Only the
+// users sharing a project and the projects sharing a tag or category are compared, so the
+// work grows with the interactions instead of the square of the users
+func recommend(projects []Project, limit int) map[primitive.ObjectID][]Recommendation {
+	interactions := make(map[primitive.ObjectID]map[int]bool)
+	interacting := make([][]primitive.ObjectID, len(projects))
+	byTag := make(map[string][]int)
+	byCategory := make(map[string][]int)
+	for index, project := range projects {
+		users := append([]primitive.ObjectID{}, project.Votes...)
+		for _, contribution := range project.Contributions {
+			users = append(users, contribution.User.ID)
+		}
+		for _, user := range users {
+			if interactions[user] == nil {
+				interactions[user] = make(map[int]bool)
+			}
+			if !interactions[user][index] {
+				interactions[user][index] = true
+				interacting[index] = append(interacting[index], user)
+			}
+		}
+
+		if project.Status == StatusActive {
+			for _, tag := range project.Tags {
+				byTag[tag] = append(byTag[tag], index)
+			}
+			if project.Category != "" {
+				byCategory[project.Category] = append(byCategory[project.Category], index)
+			}
+		}
+	}
+
+	result := make(map[primitive.ObjectID][]Recommendation, len(interactions))
+	for user, interacted := range interactions {
+		tags := make(map[string]float64)
+		categories := make(map[string]float64)
+		shared := make(map[primitive.ObjectID]int)
+		for index := range interacted {
+			for _, tag := range projects[index].Tags {
+				tags[tag]++
+			}
+			categories[projects[index].Category]++
+			for _, other := range interacting[index] {
+				if other != user {
+					shared[other]++
+				}
+			}
+		}
+
+		candidates := make(map[int]bool)
+		similar := make(map[int]float64)
+		for other, count := range shared {
+			otherInteracted := interactions[other]
+			similarity := float64(count) / math.Sqrt(float64(len(interacted)*len(otherInteracted)))
+			for index := range otherInteracted {
+				similar[index] += similarity
+				candidates[index] = true
+			}
+		}
+		for tag := range tags {
+			for _, index := range byTag[tag] {
+				candidates[index] = true
+			}
+		}
+		for category := range categories {
+			for _, index := range byCategory[category] {
+				candidates[index] = true
+			}
+		}
+
+		// Candidates are scored in the order of the projects so ties keep a stable order
+		indexes := make([]int, 0, len(candidates))
+		for index := range candidates {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+
+		total := float64(len(interacted))
+		scored := make([]Recommendation, 0)
+		for _, index := range indexes {
+			project := projects[index]
+			if interacted[index] || project.Owner == user || project.Status != StatusActive {
+				continue
+			}
+
+			score := coVotingWeight * similar[index]
+			for _, tag := range project.Tags {
+				score += tagAffinityWeight * tags[tag] / total
+			}
+			if project.Category != "" {
+				score += categoryAffinityWeight * categories[project.Category] / total
+			}
+			if score > 0 {
+				scored = append(scored, Recommendation{project.ID, score})
+			}
+		}
+
+		sort.SliceStable(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+		if len(scored) > limit {
+			scored = scored[:limit]
+		}
+		if len(scored) > 0 {
+			result[user] = scored
+		}
+	}
+	return result
+}
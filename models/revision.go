@@ -0,0 +1,295 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRevisionNotFound is returned when a project has no revision with the given id
+var ErrRevisionNotFound = errors.New("No revision found with given id")
+
+// FieldChange is the value of a project field before and after a revision, null when it was empty
+type FieldChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// Revision records who changed a project, when and which fields. Version is the project
+// version the revision produced
+type Revision struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Project   primitive.ObjectID `json:"project" bson:"project"`
+	Version   int64              `json:"version" bson:"version"`
+	Author    primitive.ObjectID `json:"author" bson:"author"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	Changes   []FieldChange      `json:"changes" bson:"changes"`
+}
+
+// RevisionPage is a page of project revisions with the cursor to request the next one
+type RevisionPage struct {
+	Revisions  []Revision `json:"revisions"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// RevisionStore contains the operations on the revision history of projects
+type RevisionStore struct {
+	collection *mongo.Collection
+}
+
+// NewRevisionStore creates a revision store with a mongo database
+func NewRevisionStore(database *mongo.Database) *RevisionStore {
+	return &RevisionStore{database.Collection("project_revisions")}
+}
+
+// CreateIndexes creates the indexes used to list revisions if they don't exist
+func (rs *RevisionStore) CreateIndexes(ctx context.Context) error {
+	_, err := rs.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "project", Value: 1}, {Key: "_id", Value: -1}},
+	})
+	return err
+}
+
+// Create stores a revision
+func (rs *RevisionStore) Create(ctx context.Context, revision Revision) error {
+	defer metrics.ObserveStore("revisions", "Create", time.Now())
+
+	_, err := rs.collection.InsertOne(ctx, revision)
+	return err
+}
+
+// GetByProject returns a page of the revisions of a project, newest first
+func (rs *RevisionStore) GetByProject(ctx context.Context, projectID string, page Page) (RevisionPage, error) {
+	defer metrics.ObserveStore("revisions", "GetByProject", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(projectID)
+	if err != nil {
+		return RevisionPage{}, err
+	}
+
+	filter := bson.M{"project": pid}
+	if page.Cursor != "" {
+		pc, err := decodeCursor(page.Cursor)
+		if err != nil || pc.Field != newestFirst.Field {
+			return RevisionPage{}, ErrInvalidCursor
+		}
+		filter = matchAll(filter, newestFirst.after(pc))
+	}
+
+	// One extra revision is requested to know if there is a next page
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(page.limit() + 1)
+	cursor, err := rs.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return RevisionPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	result := RevisionPage{Revisions: make([]Revision, 0)}
+	if err := cursor.All(ctx, &result.Revisions); err != nil {
+		return RevisionPage{}, err
+	}
+	plainChanges(result.Revisions)
+
+	if int64(len(result.Revisions)) > page.limit() {
+		result.Revisions = result.Revisions[:page.limit()]
+		last := result.Revisions[len(result.Revisions)-1]
+		result.NextCursor, err = encodeCursor(newestFirst.Field, bson.RawValue{}, last.ID)
+		if err != nil {
+			return RevisionPage{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// history returns every revision of a project, oldest first
+func (rs *RevisionStore) history(ctx context.Context, pid primitive.ObjectID) ([]Revision, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "version", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := rs.collection.Find(ctx, bson.M{"project": pid}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := make([]Revision, 0)
+	err = cursor.All(ctx, &revisions)
+	plainChanges(revisions)
+	return revisions, err
+}
+
+// plainChanges turns the documents decoded in the changes of revisions into maps and slices,
+// so they are written to JSON as objects instead of lists of keys and values
+func plainChanges(revisions []Revision) {
+	for _, revision := range revisions {
+		for index, change := range revision.Changes {
+			revision.Changes[index].Before = plainValue(change.Before)
+			revision.Changes[index].After = plainValue(change.After)
+		}
+	}
+}
+
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.D:
+		plain := make(map[string]interface{}, len(v))
+		for _, element := range v {
+			plain[element.Key] = plainValue(element.Value)
+		}
+		return plain
+	case primitive.A:
+		plain := make([]interface{}, len(v))
+		for index, element := range v {
+			plain[index] = plainValue(element)
+		}
+		return plain
+	default:
+		return value
+	}
+}
+
+// RestoreRevision brings the fields tracked by revisions back to their values right after
+// the given revision. The restore is an update itself, so it is recorded as a new revision
+func (ps *ProjectStore) RestoreRevision(ctx context.Context, id, revisionID, authorID string) (Project, error) {
+	defer metrics.ObserveStore("projects", "RestoreRevision", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Project{}, err
+	}
+
+	revisions, err := NewRevisionStore(ps.database).history(ctx, pid)
+	if err != nil {
+		return Project{}, err
+	}
+
+	target := -1
+	for index, revision := range revisions {
+		if revision.ID.Hex() == revisionID {
+			target = index
+		}
+	}
+	if target < 0 {
+		return Project{}, ErrRevisionNotFound
+	}
+
+	values := valuesAt(revisions, target)
+	keepRequired(values, projectPatchFields)
+	if len(values) == 0 {
+		return ps.GetByID(ctx, id)
+	}
+
+	body, err := json.Marshal(values)
+	if err != nil {
+		return Project{}, err
+	}
+	patch, err := ParseProjectPatch(body)
+	if err != nil {
+		return Project{}, err
+	}
+
+	return ps.Patch(ctx, id, authorID, patch)
+}
+
+// valuesAt returns the value of every field changed in the history right after the revision
+// at target: the last value it was given up to the target, or else the value it had before
+// it was first changed after the target
+func valuesAt(revisions []Revision, target int) map[string]interface{} {
+	values := make(map[string]interface{})
+	for index, revision := range revisions {
+		for _, change := range revision.Changes {
+			if index <= target {
+				values[change.Field] = change.After
+			} else if _, ok := values[change.Field]; !ok {
+				values[change.Field] = change.Before
+			}
+		}
+	}
+	return values
+}
+
+// keepRequired drops the required fields that had no value at the restored revision,
+// so they keep their current value instead of failing the patch
+func keepRequired(values map[string]interface{}, fields map[string]patchField) {
+	for name, value := range values {
+		if value == nil && fields[name].required {
+			delete(values, name)
+		}
+	}
+}
+
+// recordRevision stores the changes a patch made on the previous document of a project.
+// Failures are not reported to the caller because the project update already succeeded
+func (ps *ProjectStore) recordRevision(ctx context.Context, previous bson.Raw, version int64, authorID string, patch Patch) {
+	changes := diffPatch(previous, patch, projectPatchFields)
+	if len(changes) == 0 {
+		return
+	}
+
+	author, _ := primitive.ObjectIDFromHex(authorID)
+	revision := Revision{
+		Project:   previous.Lookup("_id").ObjectID(),
+		Version:   version,
+		Author:    author,
+		CreatedAt: time.Now(),
+		Changes:   changes,
+	}
+	_ = NewRevisionStore(ps.database).Create(ctx, revision)
+}
+
+// diffPatch returns the fields whose value the patch changed on the previous document,
+// sorted by their JSON name
+func diffPatch(previous bson.Raw, patch Patch, fields map[string]patchField) []FieldChange {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changes := make([]FieldChange, 0)
+	for _, name := range names {
+		field := fields[name]
+		if !patch.Changes(field.name) {
+			continue
+		}
+
+		before, _ := previous.LookupErr(field.name)
+		after := patch.Set[field.name]
+		if sameValue(before, after) {
+			continue
+		}
+
+		change := FieldChange{Field: name, After: after}
+		if before.Type != bsontype.Null && before.Type != 0 {
+			_ = before.Unmarshal(&change.Before)
+			change.Before = plainValue(change.Before)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// sameValue compares a stored value with a new one by their BSON encoding
+func sameValue(before bson.RawValue, after interface{}) bool {
+	if before.Type == 0 || before.Type == bsontype.Null {
+		return after == nil
+	}
+	if after == nil {
+		return false
+	}
+
+	doc, err := bson.Marshal(bson.M{"v": after})
+	if err != nil {
+		return false
+	}
+	return before.Equal(bson.Raw(doc).Lookup("v"))
+}
@@ -0,0 +1,306 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reward is a tier contributors can choose when contributing at least its minimum amount.
+// A Limit of 0 means the reward is unlimited and has no Remaining, otherwise Remaining counts the ones left
+type Reward struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id"`
+	Title             string             `json:"title" bson:"title"`
+	Description       string             `json:"description,omitempty" bson:"desc,omitempty"`
+	MinAmount         float32            `json:"min_amount" bson:"min_amount"`
+	Limit             int                `json:"limit,omitempty" bson:"limit,omitempty"`
+	Remaining         *int               `json:"remaining,omitempty" bson:"remaining,omitempty"`
+	Backers           int                `json:"backers" bson:"backers"`
+	EstimatedDelivery time.Time          `json:"estimated_delivery,omitempty" bson:"estimated_delivery,omitempty"`
+}
+
+var (
+	// ErrRewardNotFound is returned when a project has no reward with the given id
+	ErrRewardNotFound = errors.New("No reward found with given id")
+	// ErrBelowMinimum is returned when a contribution is lower than the minimum of its reward
+	ErrBelowMinimum = errors.New("Contribution amount is below the reward minimum")
+	// ErrRewardSoldOut is returned when a limited reward has none left
+	ErrRewardSoldOut = errors.New("Reward is sold out")
+	// ErrRewardHasBackers is returned when removing a reward that contributors already chose
+	ErrRewardHasBackers = errors.New("Reward already has backers")
+	// ErrRewardChanged is returned when a reward got new backers while it was being edited
+	ErrRewardChanged = errors.New("Reward changed while editing, try again")
+)
+
+// EditReward holds the fields of a reward its owner can set
+type EditReward struct {
+	Title             string    `json:"title"`
+	Description       string    `json:"description,omitempty"`
+	MinAmount         float32   `json:"min_amount"`
+	Limit             int       `json:"limit,omitempty"`
+	EstimatedDelivery time.Time `json:"estimated_delivery,omitempty"`
+}
+
+// Validate checks the reward values
+func (er EditReward) Validate() error {
+	if strings.TrimSpace(er.Title) == "" {
+		return errors.New("Reward title is required")
+	}
+	if er.MinAmount <= 0 {
+		return errors.New("Reward min_amount must be greater than zero")
+	}
+	if er.Limit < 0 {
+		return errors.New("Reward limit can't be negative")
+	}
+	return nil
+}
+
+// ValidateRewards checks the rewards of a new project
+func (p Project) ValidateRewards() error {
+	for _, reward := range p.Rewards {
+		if err := reward.edit().Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Reward) edit() EditReward {
+	return EditReward{r.Title, r.Description, r.MinAmount, r.Limit, r.EstimatedDelivery}
+}
+
+// newReward creates a reward without backers
+func newReward(er EditReward) Reward {
+	reward := Reward{
+		ID:                primitive.NewObjectID(),
+		Title:             er.Title,
+		Description:       er.Description,
+		MinAmount:         er.MinAmount,
+		Limit:             er.Limit,
+		EstimatedDelivery: er.EstimatedDelivery,
+	}
+	if reward.limited() {
+		remaining := er.Limit
+		reward.Remaining = &remaining
+	}
+	return reward
+}
+
+// limited reports if the reward has a fixed quantity
+func (r Reward) limited() bool {
+	return r.Limit > 0
+}
+
+// AddReward adds a reward tier to a project
+func (ps *ProjectStore) AddReward(ctx context.Context, id string, er EditReward) (Reward, error) {
+	defer metrics.ObserveStore("projects", "AddReward", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Reward{}, err
+	}
+
+	reward := newReward(er)
+	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$push": bson.M{"rewards": reward}})
+	if err != nil {
+		return Reward{}, err
+	}
+
+	if result.MatchedCount == 0 {
+		return Reward{}, errors.New("No project found with given id")
+	}
+
+	return reward, nil
+}
+
+// UpdateReward edits a reward tier. A limited reward can't go below the backers it already has
+func (ps *ProjectStore) UpdateReward(ctx context.Context, id, rewardID string, er EditReward) error {
+	defer metrics.ObserveStore("projects", "UpdateReward", time.Now())
+
+	pid, rid, err := rewardIDs(id, rewardID)
+	if err != nil {
+		return err
+	}
+
+	reward, err := ps.getReward(ctx, pid, rid)
+	if err != nil {
+		return err
+	}
+	if er.Limit > 0 && er.Limit < reward.Backers {
+		return errors.New("Reward limit can't be lower than its backers")
+	}
+
+	set := bson.M{
+		"rewards.$.title":              er.Title,
+		"rewards.$.desc":               er.Description,
+		"rewards.$.min_amount":         er.MinAmount,
+		"rewards.$.limit":              er.Limit,
+		"rewards.$.estimated_delivery": er.EstimatedDelivery,
+	}
+	update := bson.M{"$set": set}
+	if er.Limit > 0 {
+		set["rewards.$.remaining"] = er.Limit - reward.Backers
+	} else {
+		update["$unset"] = bson.M{"rewards.$.remaining": ""}
+	}
+
+	// The backers are part of the filter so a contribution made meanwhile isn't lost from remaining
+	filter := bson.M{"_id": pid, "rewards": bson.M{"$elemMatch": bson.M{"_id": rid, "backers": reward.Backers}}}
+	result, err := ps.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRewardChanged
+	}
+
+	return nil
+}
+
+// RemoveReward removes a reward tier that has no backers
+func (ps *ProjectStore) RemoveReward(ctx context.Context, id, rewardID string) error {
+	defer metrics.ObserveStore("projects", "RemoveReward", time.Now())
+
+	pid, rid, err := rewardIDs(id, rewardID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$pull": bson.M{"rewards": bson.M{"_id": rid, "backers": 0}}}
+	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": pid, "rewards._id": rid}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRewardNotFound
+	}
+	if result.ModifiedCount == 0 {
+		return ErrRewardHasBackers
+	}
+
+	return nil
+}
+
+// GetRewardBackers returns the contributions that chose a reward, with their users
+func (ps *ProjectStore) GetRewardBackers(ctx context.Context, id, rewardID string) ([]Contribution, error) {
+	defer metrics.ObserveStore("projects", "GetRewardBackers", time.Now())
+
+	pid, rid, err := rewardIDs(id, rewardID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ps.getReward(ctx, pid, rid); err != nil {
+		return nil, err
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"_id": pid}},
+		bson.M{"$project": bson.M{"contributions": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$contributions", bson.A{}}},
+			"cond":  bson.M{"$eq": bson.A{"$$this.reward", rid}},
+		}}}},
+	}
+	cursor, err := ps.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	project := Project{Contributions: make([]Contribution, 0)}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&project); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	ps.getContributionsUsers(ctx, &project)
+	return project.Contributions, nil
+}
+
+// getReward finds a reward of a project
+func (ps *ProjectStore) getReward(ctx context.Context, pid, rid primitive.ObjectID) (Reward, error) {
+	var project Project
+	findOptions := options.FindOne().SetProjection(bson.M{"rewards.$": 1})
+	err := ps.collection.FindOne(ctx, bson.M{"_id": pid, "rewards._id": rid}, findOptions).Decode(&project)
+	if err == mongo.ErrNoDocuments {
+		if err := ps.exists(ctx, pid); err != nil {
+			return Reward{}, err
+		}
+		return Reward{}, ErrRewardNotFound
+	}
+	if err != nil {
+		return Reward{}, err
+	}
+	return project.Rewards[0], nil
+}
+
+// rewardContribution returns the filter and the counters to update when contributing
+// amount to a reward. The reward is only matched while amount reaches its current minimum
+// and, for limited rewards, while they have some left
+func (ps *ProjectStore) rewardContribution(ctx context.Context, pid primitive.ObjectID, rewardID string, amount float32) (bson.M, bson.M, error) {
+	rid, err := primitive.ObjectIDFromHex(rewardID)
+	if err != nil {
+		return nil, nil, ErrRewardNotFound
+	}
+
+	reward, err := ps.getReward(ctx, pid, rid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	match, counters := reward.contribution(amount)
+	return bson.M{"rewards": bson.M{"$elemMatch": match}}, counters, nil
+}
+
+// contribution returns the reward match and counters of a contribution of amount
+func (r Reward) contribution(amount float32) (bson.M, bson.M) {
+	match := bson.M{"_id": r.ID, "min_amount": bson.M{"$lte": amount}}
+	counters := bson.M{"rewards.$.backers": 1}
+	if r.limited() {
+		match["remaining"] = bson.M{"$gt": 0}
+		counters["rewards.$.remaining"] = -1
+	}
+	return match, counters
+}
+
+// rewardRejection explains why a contribution of amount didn't match its reward
+func (ps *ProjectStore) rewardRejection(ctx context.Context, pid primitive.ObjectID, rewardID string, amount float32) error {
+	rid, err := primitive.ObjectIDFromHex(rewardID)
+	if err != nil {
+		return ErrRewardNotFound
+	}
+
+	reward, err := ps.getReward(ctx, pid, rid)
+	if err != nil {
+		return err
+	}
+	if amount < reward.MinAmount {
+		return ErrBelowMinimum
+	}
+	return ErrRewardSoldOut
+}
+
+func rewardIDs(id, rewardID string) (primitive.ObjectID, primitive.ObjectID, error) {
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return pid, primitive.NilObjectID, err
+	}
+	rid, err := primitive.ObjectIDFromHex(rewardID)
+	if err != nil {
+		return pid, rid, ErrRewardNotFound
+	}
+	return pid, rid, nil
+}
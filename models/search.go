@@ -0,0 +1,357 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxSearchLength bounds the text used to build the fallback title pattern
+const maxSearchLength = 100
+
+var accentFolds = map[rune]rune{
+	'á': 'a', 'à': 'a', 'ä': 'a', 'â': 'a',
+	'é': 'e', 'è': 'e', 'ë': 'e', 'ê': 'e',
+	'í': 'i', 'ì': 'i', 'ï': 'i', 'î': 'i',
+	'ó': 'o', 'ò': 'o', 'ö': 'o', 'ô': 'o',
+	'ú': 'u', 'ù': 'u', 'ü': 'u', 'û': 'u',
+	'ñ': 'n',
+}
+
+var accentClasses = map[rune]string{
+	'a': "[aáàäâ]",
+	'e': "[eéèëê]",
+	'i': "[iíìïî]",
+	'o': "[oóòöô]",
+	'u': "[uúùüû]",
+	'n': "[nñ]",
+}
+
+// textIndex is the text index used for relevance search. Spanish is the default language
+// so words are stemmed accordingly, and version 3 text indexes ignore case and diacritics
+var textIndex = mongo.IndexModel{
+	Keys: bson.D{
+		{Key: "title", Value: "text"},
+		{Key: "subtitle", Value: "text"},
+		{Key: "desc", Value: "text"},
+		{Key: "tags", Value: "text"},
+	},
+	Options: options.Index().
+		SetName("projects_text").
+		SetDefaultLanguage("spanish").
+		SetWeights(bson.M{"title": 10, "tags": 5, "subtitle": 3, "desc": 1}),
+}
+
+// literalPattern builds a regex that matches text literally, ignoring accents
+func literalPattern(text string) string {
+	runes := []rune(strings.ToLower(text))
+	if len(runes) > maxSearchLength {
+		runes = runes[:maxSearchLength]
+	}
+
+	var pattern strings.Builder
+	for _, r := range runes {
+		if base, ok := accentFolds[r]; ok {
+			r = base
+		}
+		if class, ok := accentClasses[r]; ok {
+			pattern.WriteString(class)
+			continue
+		}
+		pattern.WriteString(regexp.QuoteMeta(string(r)))
+	}
+	return pattern.String()
+}
+
+// matchAll combines filters, skipping the empty ones
+func matchAll(filters ...bson.M) bson.M {
+	conditions := bson.A{}
+	for _, filter := range filters {
+		if len(filter) > 0 {
+			conditions = append(conditions, filter)
+		}
+	}
+
+	switch len(conditions) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return conditions[0].(bson.M)
+	default:
+		return bson.M{"$and": conditions}
+	}
+}
+
+// Sort orders accepted by ProjectQuery
+const (
+	SortRelevance  = "relevance"
+	SortVotes      = "votes"
+	SortViews      = "views"
+	SortNewest     = "newest"
+	SortEndingSoon = "ending_soon"
+	SortMostFunded = "most_funded"
+	SortTrending   = "trending"
+	SortDistance   = "distance"
+)
+
+var searchSorts = map[string]pageSort{
+	SortRelevance:  byRelevance,
+	SortVotes:      {"votes_count", -1},
+	SortViews:      {"views", -1},
+	SortNewest:     newestFirst,
+	SortEndingSoon: {"ends_at", 1},
+	SortMostFunded: {"funding", -1},
+	SortTrending:   trendingSort(TrendingWeek),
+	SortDistance:   {"distance", 1},
+}
+
+// maxTagFacets bounds the number of tags returned in the facets
+const maxTagFacets = 50
+
+// ProjectQuery holds the filters and order of a project search, all filters are optional
+type ProjectQuery struct {
+	Text        string     `json:"text,omitempty"`
+	Categories  []string   `json:"categories,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	AllTags     bool       `json:"all_tags,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	Owner       string     `json:"owner,omitempty"`
+	MinFunding  *float64   `json:"min_funding,omitempty"`
+	MaxFunding  *float64   `json:"max_funding,omitempty"`
+	Statuses    []string   `json:"statuses,omitempty"`
+	CreatedFrom *time.Time `json:"created_from,omitempty"`
+	CreatedTo   *time.Time `json:"created_to,omitempty"`
+	Near        *GeoNear   `json:"near,omitempty"`
+	Within      *GeoBox    `json:"within,omitempty"`
+	Sort        string     `json:"sort,omitempty"`
+}
+
+// FacetCount is the number of matching projects for a facet value
+type FacetCount struct {
+	Value string `json:"value" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// Facets holds the counts per category and tag of a search
+type Facets struct {
+	Categories []FacetCount `json:"categories" bson:"categories"`
+	Tags       []FacetCount `json:"tags" bson:"tags"`
+}
+
+// SearchResult is a page of projects matching a query and the facets of all the matches
+type SearchResult struct {
+	ProjectPage
+	Facets Facets `json:"facets"`
+}
+
+// Validate checks the query values that can't be used to search
+func (q ProjectQuery) Validate() error {
+	if q.Sort != "" {
+		if _, ok := searchSorts[q.Sort]; !ok {
+			return errors.New("Invalid sort, use relevance, votes, views, newest, ending_soon, most_funded, trending or distance")
+		}
+	}
+	if q.Owner != "" {
+		if _, err := primitive.ObjectIDFromHex(q.Owner); err != nil {
+			return errors.New("Invalid owner id")
+		}
+	}
+	if q.MinFunding != nil && q.MaxFunding != nil && *q.MinFunding > *q.MaxFunding {
+		return errors.New("min_funding can't be greater than max_funding")
+	}
+	if q.CreatedFrom != nil && q.CreatedTo != nil && q.CreatedFrom.After(*q.CreatedTo) {
+		return errors.New("created_from can't be after created_to")
+	}
+	if q.Near != nil {
+		if err := q.Near.Validate(); err != nil {
+			return err
+		}
+	} else if q.Sort == SortDistance {
+		return errors.New("Sorting by distance needs a near point")
+	}
+	if q.Within != nil {
+		if err := q.Within.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter returns the conditions of the query, without the text search and the near point
+func (q ProjectQuery) filter() bson.M {
+	conditions := []bson.M{}
+	if len(q.Categories) > 0 {
+		conditions = append(conditions, bson.M{"category": bson.M{"$in": q.Categories}})
+	}
+	if len(q.Tags) > 0 {
+		tags := make([]string, len(q.Tags))
+		for index, tag := range q.Tags {
+			tags[index] = strings.ToLower(tag)
+		}
+		operator := "$in"
+		if q.AllTags {
+			operator = "$all"
+		}
+		conditions = append(conditions, bson.M{"tags": bson.M{operator: tags}})
+	}
+	if q.Location != "" {
+		conditions = append(conditions, bson.M{"location": primitive.Regex{Pattern: literalPattern(q.Location), Options: "i"}})
+	}
+	if q.Owner != "" {
+		oid, _ := primitive.ObjectIDFromHex(q.Owner)
+		conditions = append(conditions, bson.M{"owner": oid})
+	}
+	if len(q.Statuses) > 0 {
+		conditions = append(conditions, bson.M{"status": bson.M{"$in": q.Statuses}})
+	}
+	created := bson.M{}
+	if q.CreatedFrom != nil {
+		created["$gte"] = *q.CreatedFrom
+	}
+	if q.CreatedTo != nil {
+		created["$lte"] = *q.CreatedTo
+	}
+	if len(created) > 0 {
+		conditions = append(conditions, bson.M{"created_at": created})
+	}
+	funding := bson.M{}
+	if q.MinFunding != nil {
+		funding["$gte"] = *q.MinFunding
+	}
+	if q.MaxFunding != nil {
+		funding["$lte"] = *q.MaxFunding
+	}
+	if len(funding) > 0 {
+		conditions = append(conditions, bson.M{"funding": funding})
+	}
+	if q.Within != nil {
+		conditions = append(conditions, q.Within.filter())
+	}
+	if q.Sort == SortEndingSoon {
+		conditions = append(conditions, bson.M{"status": StatusActive, "ends_at": bson.M{"$gte": time.Now()}})
+	}
+	return matchAll(conditions...)
+}
+
+// Search returns a page of the projects matching a query and the facets of all the matches
+func (ps *ProjectStore) Search(ctx context.Context, query ProjectQuery, page Page) (SearchResult, error) {
+	defer metrics.ObserveStore("projects", "Search", time.Now())
+
+	sort, ok := searchSorts[query.Sort]
+	if !ok {
+		sort = byRelevance
+	}
+
+	if len(query.Categories) > 0 {
+		// A category includes the projects of its subcategories
+		categories, err := NewCategoryStore(ps.database).Descendants(ctx, query.Categories)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		query.Categories = categories
+	}
+
+	match, indexed, err := ps.textMatch(ctx, query.Text, matchAll(query.filter(), published))
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if !indexed && sort == byRelevance {
+		// There is no text score to rank by
+		sort = newestFirst
+	}
+
+	pipeline := bson.A{bson.M{"$match": match}}
+	if query.Near != nil {
+		if indexed {
+			// $geoNear can't be combined with a text search
+			pipeline = bson.A{
+				bson.M{"$match": matchAll(match, query.Near.filter())},
+				bson.M{"$addFields": bson.M{"distance": query.Near.distance()}},
+			}
+		} else {
+			pipeline = bson.A{query.Near.stage(match)}
+		}
+	}
+
+	result := SearchResult{Facets: Facets{make([]FacetCount, 0), make([]FacetCount, 0)}}
+	result.ProjectPage, err = ps.aggregatePage(ctx, pipeline, sort, page)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	facets := append(append(bson.A{}, pipeline...), bson.M{"$facet": bson.M{
+		"categories": bson.A{bson.M{"$sortByCount": "$category"}},
+		"tags":       bson.A{bson.M{"$unwind": "$tags"}, bson.M{"$sortByCount": "$tags"}, bson.M{"$limit": maxTagFacets}},
+	}})
+	cursor, err := ps.collection.Aggregate(ctx, facets)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result.Facets); err != nil {
+			return SearchResult{}, err
+		}
+	}
+
+	return result, cursor.Err()
+}
+
+// textMatch adds the text search to filter and reports if it uses the text index.
+// When the index finds nothing, it falls back to a literal substring match on the title
+func (ps *ProjectStore) textMatch(ctx context.Context, text string, filter bson.M) (bson.M, bool, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return filter, false, nil
+	}
+
+	textFilter := matchAll(filter, bson.M{"$text": bson.M{"$search": text}})
+	err := ps.collection.FindOne(ctx, textFilter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err == nil {
+		return textFilter, true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, false, err
+	}
+
+	titleFilter := bson.M{"title": primitive.Regex{Pattern: literalPattern(text), Options: "i"}}
+	return matchAll(filter, titleFilter), false, nil
+}
+
+// ProjectSuggestion is the summary of a project shown while typing a search
+type ProjectSuggestion struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	Title    string             `json:"title" bson:"title"`
+	ImageURL string             `json:"image_url,omitempty" bson:"image,omitempty"`
+}
+
+// Suggest returns the projects with a title word starting with prefix, most voted first
+func (ps *ProjectStore) Suggest(ctx context.Context, prefix string, limit int64) ([]ProjectSuggestion, error) {
+	defer metrics.ObserveStore("projects", "Suggest", time.Now())
+
+	filter := matchAll(bson.M{"title": primitive.Regex{Pattern: `(^|\s)` + literalPattern(strings.TrimSpace(prefix)), Options: "i"}}, published)
+	findOptions := options.Find().
+		SetProjection(bson.M{"title": 1, "image": 1}).
+		SetSort(bson.D{{Key: "votes_count", Value: -1}, {Key: "views", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit)
+	cursor, err := ps.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	suggestions := make([]ProjectSuggestion, 0)
+	if err := cursor.All(ctx, &suggestions); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxSlugLength bounds the part of a slug taken from the title
+	maxSlugLength = 60
+	// slugAttempts is how many times a write is retried when another project took its slug meanwhile
+	slugAttempts = 3
+)
+
+// slugIndexes keep current and old slugs unique, so each one resolves to a single project
+var slugIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	{Keys: bson.D{{Key: "old_slugs", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+}
+
+// Slugify turns a title into a URL-safe slug of lowercase letters and digits separated by dashes,
+// accented letters are replaced by their base letter
+func Slugify(title string) string {
+	result := slugWords(title)
+	if result == "" {
+		return "proyecto"
+	}
+	if _, err := primitive.ObjectIDFromHex(result); err == nil {
+		// A slug that reads as an id would be looked up as one
+		return result + "-p"
+	}
+	return result
+}
+
+// slugWords returns the letters and digits of title as a slug, empty when it has none
+func slugWords(title string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if base, ok := accentFolds[r]; ok {
+			r = base
+		}
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			dash = true
+			continue
+		}
+		if dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+		}
+		dash = false
+		slug.WriteRune(r)
+	}
+
+	result := slug.String()
+	if len(result) > maxSlugLength {
+		result = strings.TrimRight(result[:maxSlugLength], "-")
+	}
+	return result
+}
+
+// uniqueSlug returns the slug of title, with a numeric suffix if another project uses it
+// now or used it before. The project with id except doesn't count
+func (ps *ProjectStore) uniqueSlug(ctx context.Context, title string, except primitive.ObjectID) (string, error) {
+	base := Slugify(title)
+	pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(base) + `(-\d+)?$`}
+	filter := bson.M{
+		"_id": bson.M{"$ne": except},
+		"$or": bson.A{bson.M{"slug": pattern}, bson.M{"old_slugs": pattern}},
+	}
+	cursor, err := ps.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"slug": 1, "old_slugs": 1}))
+	if err != nil {
+		return "", err
+	}
+
+	var projects []Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return "", err
+	}
+
+	taken := make(map[string]bool)
+	for _, project := range projects {
+		taken[project.Slug] = true
+		for _, slug := range project.OldSlugs {
+			taken[slug] = true
+		}
+	}
+
+	slug := base
+	for n := 2; taken[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug, nil
+}
+
+// slugStage sets a new slug in an update pipeline, keeping the current one as an old slug
+// so its links redirect. The new slug leaves the old slugs if the project had it before
+func slugStage(slug string) bson.M {
+	current := bson.M{"$cond": bson.A{
+		bson.M{"$in": bson.A{bson.M{"$type": "$slug"}, bson.A{"missing", "null"}}},
+		bson.A{},
+		bson.A{"$slug"},
+	}}
+	old := bson.M{"$setDifference": bson.A{
+		bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$old_slugs", bson.A{}}}, current}},
+		bson.A{slug},
+	}}
+	// An empty list is left out, the unique index would take it as a value shared by every project
+	return bson.M{"$set": bson.M{
+		"slug":      bson.M{"$literal": slug},
+		"old_slugs": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{old, bson.A{}}}, "$$REMOVE", old}},
+	}}
+}
+
+// GetBySlugOrID finds a project by its id, its slug or one of its old slugs
+func (ps *ProjectStore) GetBySlugOrID(ctx context.Context, key string) (Project, error) {
+	defer metrics.ObserveStore("projects", "GetBySlugOrID", time.Now())
+
+	if _, err := primitive.ObjectIDFromHex(key); err == nil {
+		return ps.GetByID(ctx, key)
+	}
+
+	var project Project
+	filter := matchAll(bson.M{"$or": bson.A{bson.M{"slug": key}, bson.M{"old_slugs": key}}}, notDeleted)
+	if err := ps.collection.FindOne(ctx, filter).Decode(&project); err != nil {
+		return Project{}, err
+	}
+
+	ps.hydrate(ctx, &project)
+	return project, nil
+}
+
+// ResolveID returns the id of the project with the given id, slug or old slug, including
+// the projects in the trash
+func (ps *ProjectStore) ResolveID(ctx context.Context, key string) (string, error) {
+	defer metrics.ObserveStore("projects", "ResolveID", time.Now())
+
+	if _, err := primitive.ObjectIDFromHex(key); err == nil {
+		return key, nil
+	}
+
+	var project Project
+	filter := bson.M{"$or": bson.A{bson.M{"slug": key}, bson.M{"old_slugs": key}}}
+	findOptions := options.FindOne().SetProjection(bson.M{"_id": 1})
+	if err := ps.collection.FindOne(ctx, filter, findOptions).Decode(&project); err != nil {
+		return "", err
+	}
+	return project.ID.Hex(), nil
+}
+
+// MigrateSlugs gives a slug to the projects created before projects had one
+func (ps *ProjectStore) MigrateSlugs(ctx context.Context) (int, error) {
+	defer metrics.ObserveStore("projects", "MigrateSlugs", time.Now())
+
+	projection := options.Find().SetProjection(bson.M{"title": 1})
+	cursor, err := ps.collection.Find(ctx, bson.M{"slug": bson.M{"$exists": false}}, projection)
+	if err != nil {
+		return 0, err
+	}
+
+	var projects []Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, project := range projects {
+		slug, err := ps.uniqueSlug(ctx, project.Title, project.ID)
+		if err != nil {
+			return migrated, err
+		}
+		filter := bson.M{"_id": project.ID, "slug": bson.M{"$exists": false}}
+		if _, err := ps.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"slug": slug}}); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
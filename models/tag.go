@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tagsCollection holds how many projects use each tag
+const tagsCollection = "tags"
+
+// Tag represents a project tag and the number of projects using it
+type Tag struct {
+	Name  string `json:"name" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// TagStore contains the operations on tag usage
+type TagStore struct {
+	collection *mongo.Collection
+}
+
+// NewTagStore creates a tag store with a mongo database
+func NewTagStore(database *mongo.Database) *TagStore {
+	return &TagStore{database.Collection(tagsCollection)}
+}
+
+// Track updates the usage of the tags added to and removed from a project
+func (ts *TagStore) Track(ctx context.Context, added, removed []string) error {
+	defer metrics.ObserveStore("tags", "Track", time.Now())
+
+	models := make([]mongo.WriteModel, 0, len(added)+len(removed))
+	for _, tag := range uniqueTags(added) {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": tag}).
+			SetUpdate(bson.M{"$inc": bson.M{"count": 1}}).
+			SetUpsert(true))
+	}
+	for _, tag := range uniqueTags(removed) {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": tag}).
+			SetUpdate(bson.M{"$inc": bson.M{"count": -1}}))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	if _, err := ts.collection.BulkWrite(ctx, models); err != nil {
+		return err
+	}
+
+	_, err := ts.collection.DeleteMany(ctx, bson.M{"count": bson.M{"$lte": 0}})
+	return err
+}
+
+// Suggest returns the tags starting with prefix, most used first
+func (ts *TagStore) Suggest(ctx context.Context, prefix string, limit int64) ([]Tag, error) {
+	defer metrics.ObserveStore("tags", "Suggest", time.Now())
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	filter := bson.M{"_id": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix), Options: ""}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}).SetLimit(limit)
+	cursor, err := ts.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tags := make([]Tag, 0)
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// diffTags returns the tags only in after and the tags only in before
+func diffTags(before, after []string) (added, removed []string) {
+	beforeSet := make(map[string]bool)
+	for _, tag := range before {
+		beforeSet[tag] = true
+	}
+	afterSet := make(map[string]bool)
+	for _, tag := range after {
+		afterSet[tag] = true
+		if !beforeSet[tag] {
+			added = append(added, tag)
+		}
+	}
+	for _, tag := range before {
+		if !afterSet[tag] {
+			removed = append(removed, tag)
+		}
+	}
+	return uniqueTags(added), uniqueTags(removed)
+}
+
+func uniqueTags(tags []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		unique = append(unique, tag)
+	}
+	return unique
+}
+
+func lowerTags(tags []string) []string {
+	for index, tag := range tags {
+		tags[index] = strings.ToLower(tag)
+	}
+	return tags
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Team roles of a project, each role can do everything the roles below it can
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Status of a team member
+const (
+	MemberInvited  = "invited"
+	MemberAccepted = "accepted"
+)
+
+var (
+	// ErrInvalidRole is returned when inviting a member with a role other than editor or viewer
+	ErrInvalidRole = errors.New("Invalid role, use editor or viewer")
+	// ErrAlreadyMember is returned when inviting a user that is already in the team
+	ErrAlreadyMember = errors.New("User is already in the project team")
+	// ErrNotInvited is returned when accepting an invitation that doesn't exist
+	ErrNotInvited = errors.New("No pending invitation for the user")
+	// ErrNotMember is returned when removing a user that is not in the team
+	ErrNotMember = errors.New("User is not in the project team")
+)
+
+// TeamMember is a user that helps the owner run a project
+type TeamMember struct {
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	Name      string             `json:"name,omitempty" bson:"-"`
+	Avatar    string             `json:"avatar,omitempty" bson:"-"`
+	Role      string             `json:"role" bson:"role"`
+	Status    string             `json:"status" bson:"status"`
+	InvitedAt time.Time          `json:"invited_at" bson:"invited_at"`
+	JoinedAt  time.Time          `json:"joined_at,omitempty" bson:"joined_at,omitempty"`
+}
+
+// RoleOf returns the role of a user in the project team, empty if the user is not in it
+// or hasn't accepted the invitation
+func (p Project) RoleOf(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if p.Owner.Hex() == userID {
+		return RoleOwner
+	}
+	for _, member := range p.Team {
+		if member.User.Hex() == userID && member.Status == MemberAccepted {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// HasRole checks if a user has at least the given role in the project team
+func (p Project) HasRole(userID, role string) bool {
+	return roleRanks[p.RoleOf(userID)] >= roleRanks[role]
+}
+
+// PublicTeam returns the members that accepted their invitation
+func (p Project) PublicTeam() []TeamMember {
+	team := make([]TeamMember, 0, len(p.Team))
+	for _, member := range p.Team {
+		if member.Status == MemberAccepted {
+			team = append(team, member)
+		}
+	}
+	return team
+}
+
+// InviteMember invites a user to the project team with a role
+func (ps *ProjectStore) InviteMember(ctx context.Context, id, userID, role string) error {
+	defer metrics.ObserveStore("projects", "InviteMember", time.Now())
+
+	if role != RoleEditor && role != RoleViewer {
+		return ErrInvalidRole
+	}
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := NewUserStore(ps.database).GetByID(ctx, userID); err != nil {
+		return errors.New("No user found with given id")
+	}
+	uid, _ := primitive.ObjectIDFromHex(userID)
+
+	member := TeamMember{User: uid, Role: role, Status: MemberInvited, InvitedAt: time.Now()}
+	filter := bson.M{"_id": pid, "owner": bson.M{"$ne": uid}, "team.user": bson.M{"$ne": uid}}
+	result, err := ps.collection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"team": member}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if err := ps.exists(ctx, pid); err != nil {
+			return err
+		}
+		return ErrAlreadyMember
+	}
+
+	return nil
+}
+
+// AcceptInvite adds an invited user to the project team
+func (ps *ProjectStore) AcceptInvite(ctx context.Context, id, userID string) error {
+	defer metrics.ObserveStore("projects", "AcceptInvite", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": pid, "team": bson.M{"$elemMatch": bson.M{"user": uid, "status": MemberInvited}}}
+	update := bson.M{"$set": bson.M{"team.$.status": MemberAccepted, "team.$.joined_at": time.Now()}}
+	result, err := ps.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotInvited
+	}
+
+	return nil
+}
+
+// RemoveMember removes a user from the project team, or cancels the invitation
+func (ps *ProjectStore) RemoveMember(ctx context.Context, id, userID string) error {
+	defer metrics.ObserveStore("projects", "RemoveMember", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$pull": bson.M{"team": bson.M{"user": uid}}}
+	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": pid, "team.user": uid}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+func (ps *ProjectStore) getTeamMembers(ctx context.Context, project *Project) {
+	userStore := NewUserStore(ps.database)
+	for index, member := range project.Team {
+		user, err := userStore.GetByID(ctx, member.User.Hex())
+		if err != nil {
+			project.Team[index].Name = "Eliminado"
+			continue
+		}
+		project.Team[index].Name = user.Name
+		project.Team[index].Avatar = user.Avatar
+	}
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ownership events recorded in the ownership history of a project
+const (
+	TransferProposed  = "proposed"
+	TransferAccepted  = "accepted"
+	TransferCancelled = "cancelled"
+)
+
+var (
+	// ErrNoTransfer is returned when there is no pending transfer for the user
+	ErrNoTransfer = errors.New("No pending ownership transfer")
+	// ErrSelfTransfer is returned when the owner proposes the transfer to themselves
+	ErrSelfTransfer = errors.New("The project already belongs to the user")
+)
+
+// OwnershipTransfer is a pending proposal to hand a project to another user
+type OwnershipTransfer struct {
+	To         primitive.ObjectID `json:"to" bson:"to"`
+	ProposedAt time.Time          `json:"proposed_at" bson:"proposed_at"`
+}
+
+// OwnershipEvent is an entry of the ownership audit trail of a project
+type OwnershipEvent struct {
+	Action string             `json:"action" bson:"action"`
+	Actor  primitive.ObjectID `json:"actor" bson:"actor"`
+	From   primitive.ObjectID `json:"from" bson:"from"`
+	To     primitive.ObjectID `json:"to" bson:"to"`
+	At     time.Time          `json:"at" bson:"at"`
+}
+
+// ProposeTransfer offers the ownership of a project to another user, replacing any pending proposal
+func (ps *ProjectStore) ProposeTransfer(ctx context.Context, id, ownerID, toID string) error {
+	defer metrics.ObserveStore("projects", "ProposeTransfer", time.Now())
+
+	if ownerID == toID {
+		return ErrSelfTransfer
+	}
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(ownerID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := NewUserStore(ps.database).GetByID(ctx, toID); err != nil {
+		return errors.New("No user found with given id")
+	}
+	tid, _ := primitive.ObjectIDFromHex(toID)
+
+	now := time.Now()
+	update := bson.M{
+		"$set":  bson.M{"transfer": OwnershipTransfer{tid, now}},
+		"$push": bson.M{"ownership_history": OwnershipEvent{TransferProposed, oid, oid, tid, now}},
+	}
+	result, err := ps.collection.UpdateOne(ctx, bson.M{"_id": pid, "owner": oid}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("No project owned by the user with given id")
+	}
+
+	return nil
+}
+
+// AcceptTransfer makes the user the owner of a project proposed to them. The change
+// and its audit entry are written in a single update, and the new owner leaves the team
+func (ps *ProjectStore) AcceptTransfer(ctx context.Context, id, userID string) (previousOwner primitive.ObjectID, err error) {
+	defer metrics.ObserveStore("projects", "AcceptTransfer", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return previousOwner, err
+	}
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return previousOwner, err
+	}
+
+	var project Project
+	if err := ps.collection.FindOne(ctx, matchAll(bson.M{"_id": pid, "transfer.to": uid}, notDeleted)).Decode(&project); err != nil {
+		return previousOwner, ErrNoTransfer
+	}
+
+	event := OwnershipEvent{TransferAccepted, uid, project.Owner, uid, time.Now()}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"owner": uid,
+			"team": bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$team", bson.A{}}},
+				"cond":  bson.M{"$ne": bson.A{"$$this.user", uid}},
+			}},
+			"ownership_history": bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$ownership_history", bson.A{}}}, bson.A{event}}},
+		}},
+		bson.M{"$unset": "transfer"},
+	}
+	// The owner is part of the filter so a proposal that changed meanwhile isn't accepted
+	filter := matchAll(bson.M{"_id": pid, "owner": project.Owner, "transfer.to": uid}, notDeleted)
+	result, err := ps.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return previousOwner, err
+	}
+
+	if result.MatchedCount == 0 {
+		return previousOwner, ErrNoTransfer
+	}
+
+	return project.Owner, nil
+}
+
+// CancelTransfer withdraws a pending transfer, the owner can cancel it and the recipient can decline it
+func (ps *ProjectStore) CancelTransfer(ctx context.Context, id, userID string) error {
+	defer metrics.ObserveStore("projects", "CancelTransfer", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	var project Project
+	filter := bson.M{"_id": pid, "transfer": bson.M{"$exists": true}, "$or": bson.A{bson.M{"owner": uid}, bson.M{"transfer.to": uid}}}
+	if err := ps.collection.FindOne(ctx, filter).Decode(&project); err != nil {
+		return ErrNoTransfer
+	}
+
+	event := OwnershipEvent{TransferCancelled, uid, project.Owner, project.Transfer.To, time.Now()}
+	update := bson.M{
+		"$unset": bson.M{"transfer": ""},
+		"$push":  bson.M{"ownership_history": event},
+	}
+	result, err := ps.collection.UpdateOne(ctx, matchAll(filter, bson.M{"transfer.to": project.Transfer.To}), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNoTransfer
+	}
+
+	return nil
+}
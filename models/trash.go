@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notDeleted matches the projects that are not in the trash
+var notDeleted = bson.M{"deleted_at": bson.M{"$exists": false}}
+
+var (
+	// ErrHasContributions is returned when deleting a project that backers contributed to
+	ErrHasContributions = errors.New("Projects with contributions can't be deleted")
+	// ErrNotRestorable is returned when restoring a project that isn't in the owner's trash
+	ErrNotRestorable = errors.New("No deleted project to restore, it may be past its restore window")
+)
+
+// Restore takes a project out of its owner's trash if it was deleted within the window
+func (ps *ProjectStore) Restore(ctx context.Context, id, ownerID string, window time.Duration) error {
+	defer metrics.ObserveStore("projects", "Restore", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(ownerID)
+	if err != nil {
+		return err
+	}
+
+	var restored Project
+	filter := bson.M{"_id": pid, "owner": oid, "deleted_at": bson.M{"$gt": time.Now().Add(-window)}}
+	updateOptions := options.FindOneAndUpdate().SetProjection(bson.M{"tags": 1, "status": 1})
+	err = ps.collection.FindOneAndUpdate(ctx, filter, bson.M{"$unset": bson.M{"deleted_at": ""}}, updateOptions).Decode(&restored)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotRestorable
+	}
+	if err != nil {
+		return err
+	}
+
+	if restored.Status != StatusDraft {
+		ps.trackTags(ctx, restored.Tags, nil)
+	}
+	return nil
+}
+
+// GetDeleted returns a page of the projects in the owner's trash that can still be restored
+func (ps *ProjectStore) GetDeleted(ctx context.Context, ownerID string, window time.Duration, page Page) (ProjectPage, error) {
+	defer metrics.ObserveStore("projects", "GetDeleted", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(ownerID)
+	if err != nil {
+		return ProjectPage{}, err
+	}
+
+	filter := bson.M{"owner": oid, "deleted_at": bson.M{"$gt": time.Now().Add(-window)}}
+	return ps.findPage(ctx, filter, newestFirst, page)
+}
+
+// PurgeDeleted permanently removes the projects deleted before the given time with everything
+// that refers to them, and returns how many were removed
+func (ps *ProjectStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	defer metrics.ObserveStore("projects", "PurgeDeleted", time.Now())
+
+	// Projects with contributions can't be deleted, they are left out in case one slipped in
+	filter := bson.M{"deleted_at": bson.M{"$lte": before}, "contributions.0": bson.M{"$exists": false}}
+	cursor, err := ps.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &expired); err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(expired))
+	for _, project := range expired {
+		ids = append(ids, project.ID)
+	}
+
+	result, err := ps.collection.DeleteMany(ctx, matchAll(filter, bson.M{"_id": bson.M{"$in": ids}}))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, reference := range ps.references(ids) {
+		if reference.update == nil {
+			_, err = reference.collection.DeleteMany(ctx, reference.filter)
+		} else {
+			_, err = reference.collection.UpdateMany(ctx, reference.filter, reference.update)
+		}
+		if err != nil {
+			return result.DeletedCount, err
+		}
+	}
+
+	return result.DeletedCount, nil
+}
+
+// projectReference is a collection that refers to projects, with the filter of the documents
+// that refer to some of them and the update that removes the references. Documents without
+// an update are removed
+type projectReference struct {
+	collection *mongo.Collection
+	filter     bson.M
+	update     bson.M
+}
+
+// references returns where the projects with the given ids are referred to
+func (ps *ProjectStore) references(ids []primitive.ObjectID) []projectReference {
+	related := bson.M{"project": bson.M{"$in": ids}}
+	recommended := bson.M{"projects.project": bson.M{"$in": ids}}
+	curated := bson.M{"projects": bson.M{"$in": ids}}
+	return []projectReference{
+		{NewUpdateStore(ps.database).collection, related, nil},
+		{NewRevisionStore(ps.database).collection, related, nil},
+		{NewNotificationStore(ps.database).collection, related, nil},
+		{NewActivityStore(ps.database).collection, related, nil},
+		{NewRecommendationStore(ps.database).collection, recommended, bson.M{"$pull": bson.M{"projects": related}}},
+		{NewCurationStore(ps.database).collection, curated, bson.M{"$pull": curated}},
+	}
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of project activity counted by the trending score
+const (
+	ActivityVote         = "vote"
+	ActivityView         = "view"
+	ActivityComment      = "comment"
+	ActivityContribution = "contribution"
+)
+
+// activityWeights is how much each kind of activity adds to the trending score
+var activityWeights = map[string]float64{
+	ActivityVote:         3,
+	ActivityView:         0.1,
+	ActivityComment:      2,
+	ActivityContribution: 5,
+}
+
+// Trending windows, each score counts the activity of its window
+const (
+	TrendingDay   = "day"
+	TrendingWeek  = "week"
+	TrendingMonth = "month"
+)
+
+// trendingWindows are the length of each trending window. Activity loses half its weight
+// every quarter of the window, so recent activity ranks higher
+var trendingWindows = map[string]time.Duration{
+	TrendingDay:   24 * time.Hour,
+	TrendingWeek:  7 * 24 * time.Hour,
+	TrendingMonth: 30 * 24 * time.Hour,
+}
+
+// activityRetention is how long activity is kept, enough for the longest window
+const activityRetention = 31 * 24 * time.Hour
+
+// ErrInvalidWindow is returned when asking for a trending window other than day, week or month
+var ErrInvalidWindow = errors.New("Invalid window, use day, week or month")
+
+// Activity is an interaction with a project counted by the trending score
+type Activity struct {
+	Project primitive.ObjectID `bson:"project"`
+	Kind    string             `bson:"kind"`
+	Weight  float64            `bson:"weight"`
+	At      time.Time          `bson:"at"`
+}
+
+// ActivityStore contains the recent activity of projects
+type ActivityStore struct {
+	collection *mongo.Collection
+}
+
+// NewActivityStore creates an activity store with a mongo database
+func NewActivityStore(database *mongo.Database) *ActivityStore {
+	return &ActivityStore{database.Collection("project_activity")}
+}
+
+// CreateIndexes creates the index that expires old activity if it doesn't exist
+func (as *ActivityStore) CreateIndexes(ctx context.Context) error {
+	_, err := as.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(activityRetention / time.Second)),
+	})
+	return err
+}
+
+// Record stores an interaction with a project
+func (as *ActivityStore) Record(ctx context.Context, project primitive.ObjectID, kind string) error {
+	defer metrics.ObserveStore("activity", "Record", time.Now())
+
+	_, err := as.collection.InsertOne(ctx, Activity{project, kind, activityWeights[kind], time.Now()})
+	return err
+}
+
+// trackActivity records an interaction for the trending score. Failures are not reported to
+// the caller because the interaction already succeeded, it only ranks a bit lower
+func (ps *ProjectStore) trackActivity(ctx context.Context, project primitive.ObjectID, kind string) {
+	_ = NewActivityStore(ps.database).Record(ctx, project, kind)
+}
+
+// trendingSort orders projects by their score in a trending window
+func trendingSort(window string) pageSort {
+	return pageSort{"trending." + window, -1}
+}
+
+// GetTrending returns a page of the published projects with activity in the window, by trending score
+func (ps *ProjectStore) GetTrending(ctx context.Context, window string, page Page) (ProjectPage, error) {
+	defer metrics.ObserveStore("projects", "GetTrending", time.Now())
+
+	if _, ok := trendingWindows[window]; !ok {
+		return ProjectPage{}, ErrInvalidWindow
+	}
+
+	filter := matchAll(published, bson.M{"trending." + window: bson.M{"$gt": 0}})
+	return ps.findPage(ctx, filter, trendingSort(window), page)
+}
+
+// RefreshTrending recomputes the trending score of every window from the recent activity.
+// The new scores replace the old ones in place, and only then the projects without activity
+// in the window are reset, so the trending lists are never empty while refreshing
+func (ps *ProjectStore) RefreshTrending(ctx context.Context, now time.Time) error {
+	defer metrics.ObserveStore("projects", "RefreshTrending", time.Now())
+
+	activity := NewActivityStore(ps.database).collection
+	for window, length := range trendingWindows {
+		cursor, err := activity.Aggregate(ctx, trendingPipeline(window, length, now))
+		if err != nil {
+			return err
+		}
+		if err := cursor.Close(ctx); err != nil {
+			return err
+		}
+
+		field := "trending." + window
+		stale := bson.M{field: bson.M{"$gt": 0}, "trending_refreshed." + window: bson.M{"$ne": now}}
+		if _, err := ps.collection.UpdateMany(ctx, stale, bson.M{"$set": bson.M{field: 0}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trendingPipeline adds up the decayed weight of the activity of each project in a window
+// and merges the scores into the projects, stamped with the time of the refresh
+func trendingPipeline(window string, length time.Duration, now time.Time) bson.A {
+	halfLife := float64(length / 4 / time.Millisecond)
+	age := bson.M{"$subtract": bson.A{now, "$at"}}
+	decay := bson.M{"$pow": bson.A{0.5, bson.M{"$divide": bson.A{age, halfLife}}}}
+
+	return bson.A{
+		bson.M{"$match": bson.M{"at": bson.M{"$gt": now.Add(-length), "$lte": now}}},
+		bson.M{"$group": bson.M{
+			"_id":   "$project",
+			"score": bson.M{"$sum": bson.M{"$multiply": bson.A{"$weight", decay}}},
+		}},
+		bson.M{"$merge": bson.M{
+			"into": "projects",
+			"on":   "_id",
+			"whenMatched": bson.A{bson.M{"$set": bson.M{
+				"trending." + window:           "$$new.score",
+				"trending_refreshed." + window: now,
+			}}},
+			"whenNotMatched": "discard",
+		}},
+	}
+}
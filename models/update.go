@@ -0,0 +1,252 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jpr98/apis_pf_back/metrics"
+	"github.com/microcosm-cc/bluemonday"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Visibility of a project update
+const (
+	VisibilityPublic  = "public"
+	VisibilityBackers = "backers"
+)
+
+// bodyPolicy keeps the formatting of rich text bodies and drops scripts and unsafe attributes
+var bodyPolicy = bluemonday.UGCPolicy()
+
+// ProjectUpdate is a post by a project owner with news for its backers
+type ProjectUpdate struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Project    primitive.ObjectID `json:"project" bson:"project"`
+	Author     primitive.ObjectID `json:"author" bson:"author"`
+	Title      string             `json:"title" bson:"title"`
+	Body       string             `json:"body" bson:"body"`
+	Media      []string           `json:"media,omitempty" bson:"media,omitempty"`
+	Visibility string             `json:"visibility" bson:"visibility"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+}
+
+// EditUpdate holds the fields of an update its author can set
+type EditUpdate struct {
+	Title      string   `json:"title"`
+	Body       string   `json:"body"`
+	Media      []string `json:"media,omitempty"`
+	Visibility string   `json:"visibility,omitempty"`
+}
+
+// UpdatePage is a page of project updates with the cursor to request the next one
+type UpdatePage struct {
+	Updates    []ProjectUpdate `json:"updates"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// ErrUpdateNotFound is returned when a project has no update with the given id
+var ErrUpdateNotFound = errors.New("No update found with given id")
+
+// Validate checks the update values and defaults the visibility to public
+func (eu *EditUpdate) Validate() error {
+	if strings.TrimSpace(eu.Title) == "" {
+		return errors.New("Update title is required")
+	}
+	if strings.TrimSpace(eu.Body) == "" {
+		return errors.New("Update body is required")
+	}
+	switch eu.Visibility {
+	case "":
+		eu.Visibility = VisibilityPublic
+	case VisibilityPublic, VisibilityBackers:
+	default:
+		return errors.New("Invalid visibility, use public or backers")
+	}
+	return nil
+}
+
+// UpdateStore contains the operations on project updates
+type UpdateStore struct {
+	collection *mongo.Collection
+}
+
+// NewUpdateStore creates an update store with a mongo database
+func NewUpdateStore(database *mongo.Database) *UpdateStore {
+	return &UpdateStore{database.Collection("updates")}
+}
+
+// CreateIndexes creates the indexes used by the project feeds if they don't exist
+func (us *UpdateStore) CreateIndexes(ctx context.Context) error {
+	_, err := us.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "project", Value: 1}, {Key: "_id", Value: -1}},
+	})
+	return err
+}
+
+// Create posts an update on a project
+func (us *UpdateStore) Create(ctx context.Context, projectID, authorID string, eu EditUpdate) (ProjectUpdate, error) {
+	defer metrics.ObserveStore("updates", "Create", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(projectID)
+	if err != nil {
+		return ProjectUpdate{}, err
+	}
+
+	aid, err := primitive.ObjectIDFromHex(authorID)
+	if err != nil {
+		return ProjectUpdate{}, err
+	}
+
+	update := ProjectUpdate{
+		Project:    pid,
+		Author:     aid,
+		Title:      eu.Title,
+		Body:       bodyPolicy.Sanitize(eu.Body),
+		Media:      eu.Media,
+		Visibility: eu.Visibility,
+		CreatedAt:  time.Now(),
+	}
+	result, err := us.collection.InsertOne(ctx, update)
+	if err != nil {
+		return ProjectUpdate{}, err
+	}
+
+	generatedID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return ProjectUpdate{}, errors.New("Invalid generated id on update")
+	}
+	update.ID = generatedID
+
+	return update, nil
+}
+
+// Edit replaces the content of an update
+func (us *UpdateStore) Edit(ctx context.Context, projectID, updateID string, eu EditUpdate) error {
+	defer metrics.ObserveStore("updates", "Edit", time.Now())
+
+	filter, err := updateFilter(projectID, updateID)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{
+		"title":      eu.Title,
+		"body":       bodyPolicy.Sanitize(eu.Body),
+		"media":      eu.Media,
+		"visibility": eu.Visibility,
+		"updated_at": time.Now(),
+	}
+	result, err := us.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUpdateNotFound
+	}
+
+	return nil
+}
+
+// Delete removes an update
+func (us *UpdateStore) Delete(ctx context.Context, projectID, updateID string) error {
+	defer metrics.ObserveStore("updates", "Delete", time.Now())
+
+	filter, err := updateFilter(projectID, updateID)
+	if err != nil {
+		return err
+	}
+
+	result, err := us.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrUpdateNotFound
+	}
+
+	return nil
+}
+
+// GetByID finds an update of a project
+func (us *UpdateStore) GetByID(ctx context.Context, projectID, updateID string) (ProjectUpdate, error) {
+	defer metrics.ObserveStore("updates", "GetByID", time.Now())
+
+	filter, err := updateFilter(projectID, updateID)
+	if err != nil {
+		return ProjectUpdate{}, err
+	}
+
+	var update ProjectUpdate
+	err = us.collection.FindOne(ctx, filter).Decode(&update)
+	if err == mongo.ErrNoDocuments {
+		return ProjectUpdate{}, ErrUpdateNotFound
+	}
+	return update, err
+}
+
+// GetByProject returns a page of the updates of a project, newest first.
+// Backers only updates are left out unless backers is true
+func (us *UpdateStore) GetByProject(ctx context.Context, projectID string, backers bool, page Page) (UpdatePage, error) {
+	defer metrics.ObserveStore("updates", "GetByProject", time.Now())
+
+	pid, err := primitive.ObjectIDFromHex(projectID)
+	if err != nil {
+		return UpdatePage{}, err
+	}
+
+	filter := bson.M{"project": pid}
+	if !backers {
+		filter["visibility"] = VisibilityPublic
+	}
+	if page.Cursor != "" {
+		pc, err := decodeCursor(page.Cursor)
+		if err != nil || pc.Field != newestFirst.Field {
+			return UpdatePage{}, ErrInvalidCursor
+		}
+		filter = matchAll(filter, newestFirst.after(pc))
+	}
+
+	// One extra update is requested to know if there is a next page
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(page.limit() + 1)
+	cursor, err := us.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return UpdatePage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	result := UpdatePage{Updates: make([]ProjectUpdate, 0)}
+	if err := cursor.All(ctx, &result.Updates); err != nil {
+		return UpdatePage{}, err
+	}
+
+	if int64(len(result.Updates)) > page.limit() {
+		result.Updates = result.Updates[:page.limit()]
+		last := result.Updates[len(result.Updates)-1]
+		result.NextCursor, err = encodeCursor(newestFirst.Field, bson.RawValue{}, last.ID)
+		if err != nil {
+			return UpdatePage{}, err
+		}
+	}
+
+	return result, nil
+}
+
+func updateFilter(projectID, updateID string) (bson.M, error) {
+	pid, err := primitive.ObjectIDFromHex(projectID)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := primitive.ObjectIDFromHex(updateID)
+	if err != nil {
+		return nil, ErrUpdateNotFound
+	}
+	return bson.M{"_id": uid, "project": pid}, nil
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"time"
 
+	"github.com/jpr98/apis_pf_back/metrics"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,8 +24,13 @@ type User struct {
 	Bio       string             `json:"bio,omitempty" bson:"bio,omitempty"`
 	Location  string             `json:"location,omitempty" bson:"location,omitempty"`
 	Birthdate string             `json:"birthdate,omitempty" bson:"birthdate,omitempty"`
+	Role      string             `json:"role,omitempty" bson:"role,omitempty"`
+	Version   int64              `json:"version" bson:"version,omitempty"`
 }
 
+// RoleAdmin is the role of staff users, it can only be granted directly in the database
+const RoleAdmin = "admin"
+
 // UserStore contains all the CRUD operations for the User model
 type UserStore struct {
 	collection *mongo.Collection
@@ -35,9 +42,8 @@ func NewUserStore(database *mongo.Database) *UserStore {
 }
 
 // Create stores a new user in the users collection
-func (us *UserStore) Create(u User) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (us *UserStore) Create(ctx context.Context, u User) (User, error) {
+	defer metrics.ObserveStore("users", "Create", time.Now())
 
 	var err error
 	u.Password, err = generatePassword(u.Password)
@@ -46,6 +52,8 @@ func (us *UserStore) Create(u User) (User, error) {
 	}
 
 	u.Status = "active"
+	u.Role = ""
+	u.Version = 0
 
 	result, err := us.collection.InsertOne(ctx, u)
 	if err != nil {
@@ -62,9 +70,8 @@ func (us *UserStore) Create(u User) (User, error) {
 }
 
 // ValidEmail checks if an email is already taken
-func (us *UserStore) ValidEmail(email string) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (us *UserStore) ValidEmail(ctx context.Context, email string) bool {
+	defer metrics.ObserveStore("users", "ValidEmail", time.Now())
 
 	var user User
 	err := us.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
@@ -72,9 +79,8 @@ func (us *UserStore) ValidEmail(email string) bool {
 }
 
 // GetByID gets a user with a given id from the database
-func (us *UserStore) GetByID(id string) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (us *UserStore) GetByID(ctx context.Context, id string) (User, error) {
+	defer metrics.ObserveStore("users", "GetByID", time.Now())
 
 	var user User
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -90,10 +96,22 @@ func (us *UserStore) GetByID(id string) (User, error) {
 	return user, nil
 }
 
+// IsAdmin checks if the user with the given id currently has the admin role
+func (us *UserStore) IsAdmin(ctx context.Context, id string) (bool, error) {
+	defer metrics.ObserveStore("users", "IsAdmin", time.Now())
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+
+	count, err := us.collection.CountDocuments(ctx, bson.M{"_id": oid, "role": RoleAdmin})
+	return count > 0, err
+}
+
 // GetByEmail retrieves a user by a given email
-func (us *UserStore) GetByEmail(email string) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (us *UserStore) GetByEmail(ctx context.Context, email string) (User, error) {
+	defer metrics.ObserveStore("users", "GetByEmail", time.Now())
 
 	var user User
 	err := us.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
@@ -103,41 +121,47 @@ func (us *UserStore) GetByEmail(email string) (User, error) {
 	return user, nil
 }
 
-// EditUser helps while editing a users' info
-type EditUser struct {
-	Name      string `json:"name,omitempty"`
-	Location  string `json:"location,omitempty"`
-	Birthdate string `json:"birthdate,omitempty"`
-	Avatar    string `json:"avatar,omitempty"`
-	Bio       string `json:"bio,omitempty"`
+// userPatchFields are the profile fields a user can edit, by their JSON name.
+// avatar is still accepted as an alias of avatar_url for older clients
+var userPatchFields = map[string]patchField{
+	"name":       {"name", true, decodeRequiredString},
+	"location":   {"location", false, decodeString},
+	"birthdate":  {"birthdate", false, decodeString},
+	"avatar_url": {"avatar", false, decodeString},
+	"avatar":     {"avatar", false, decodeString},
+	"bio":        {"bio", false, decodeString},
 }
 
-// Update updates a users info
-func (us *UserStore) Update(id string, editUser EditUser) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	user, err := us.GetByID(id)
-	if err != nil {
-		return err
-	}
+// ParseUserPatch reads the changes of a partial profile update
+func ParseUserPatch(body []byte) (Patch, error) {
+	return parsePatch(body, userPatchFields)
+}
 
-	user.Name = editUser.Name
-	user.Location = editUser.Location
-	user.Birthdate = editUser.Birthdate
-	user.Avatar = editUser.Avatar
-	user.Bio = editUser.Bio
+// Patch applies a partial update to a user's info and returns the updated user, failing
+// with ErrVersionConflict when the patch has a version and the user changed since then
+func (us *UserStore) Patch(ctx context.Context, id string, patch Patch) (User, error) {
+	defer metrics.ObserveStore("users", "Patch", time.Now())
 
-	result, err := us.collection.ReplaceOne(ctx, bson.M{"_id": user.ID}, user)
+	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return User{}, err
 	}
 
-	if result.MatchedCount == 0 {
-		return errors.New("No user with given id")
+	var user User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := versionFilter(bson.M{"_id": oid}, patch.Version)
+	err = us.collection.FindOneAndUpdate(ctx, filter, patch.pipeline(), opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		if _, err := us.GetByID(ctx, id); err != nil {
+			return User{}, errors.New("No user with given id")
+		}
+		return User{}, ErrVersionConflict
+	}
+	if err != nil {
+		return User{}, err
 	}
 
-	return nil
+	return user, nil
 }
 
 func generatePassword(plainTextPassword string) (string, error) {
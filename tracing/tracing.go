@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "apis_pf_back"
+
+// Init registers the global tracer provider selected by $OTEL_EXPORTER:
+// "otlp" sends spans to $OTEL_EXPORTER_OTLP_ENDPOINT, "stdout" prints them,
+// and anything else keeps the default no-op provider. The returned func flushes
+// the pending spans and must be called before exiting
+func Init() (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var processor sdktrace.TracerProviderOption
+	switch os.Getenv("OTEL_EXPORTER") {
+	case "otlp":
+		options := []otlp.ExporterOption{}
+		if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+			options = append(options, otlp.WithAddress(endpoint))
+		}
+		if insecure, _ := strconv.ParseBool(os.Getenv("OTEL_EXPORTER_OTLP_INSECURE")); insecure {
+			options = append(options, otlp.WithInsecure())
+		}
+		exporter, err := otlp.NewExporter(options...)
+		if err != nil {
+			return nil, err
+		}
+		processor = sdktrace.WithBatcher(exporter)
+
+	case "stdout":
+		exporter, err := stdout.NewExporter(stdout.WithPrettyPrint(), stdout.WithoutMetricExport())
+		if err != nil {
+			return nil, err
+		}
+		processor = sdktrace.WithSyncer(exporter)
+
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used across the server
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/jpr98/apis_pf_back")
+}
+
+// Middleware starts a server span for every request, continuing any trace
+// propagated by the client, and stores it in the request context.
+// It must be the outermost middleware so the response status is final when the span ends
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), req.Header)
+
+			route := c.Path()
+			ctx, span := Tracer().Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(serviceName, route, req)...),
+			)
+			defer span.End()
+
+			c.SetRequest(req.WithContext(ctx))
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+			return err
+		}
+	}
+}
+
+// MongoMonitor returns a command monitor that records a client span for every mongo command
+func MongoMonitor() *event.CommandMonitor {
+	var mutex sync.Mutex
+	spans := make(map[int64]trace.Span)
+
+	end := func(requestID int64, err error) {
+		mutex.Lock()
+		span, ok := spans[requestID]
+		delete(spans, requestID)
+		mutex.Unlock()
+		if !ok {
+			return
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			attributes := []label.KeyValue{
+				semconv.DBSystemMongodb,
+				semconv.DBNameKey.String(e.DatabaseName),
+				semconv.DBOperationKey.String(e.CommandName),
+			}
+			if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				attributes = append(attributes, semconv.DBMongoDBCollectionKey.String(collection))
+			}
+
+			_, span := Tracer().Start(ctx, "mongo."+e.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attributes...),
+			)
+			mutex.Lock()
+			spans[e.RequestID] = span
+			mutex.Unlock()
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			end(e.RequestID, nil)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			end(e.RequestID, errors.New(e.Failure))
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := new(oteltest.StandardSpanRecorder)
+	otel.SetTracerProvider(oteltest.NewTracerProvider(oteltest.WithSpanRecorder(recorder)))
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/projects/:id", func(c echo.Context) error {
+		if !trace.SpanFromContext(c.Request().Context()).SpanContext().IsValid() {
+			t.Error("Request context should contain the server span")
+		}
+		return c.NoContent(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/projects/1", nil)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Completed()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+
+	if spans[0].Name() != "GET /projects/:id" {
+		t.Error("Span should be named after the route")
+	}
+}
+
+func TestInitWithoutExporter(t *testing.T) {
+	shutdown, err := Init()
+	if err != nil {
+		t.Fatal("Init should not fail without an exporter configured")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error("Shutting down the no-op provider should not fail")
+	}
+}